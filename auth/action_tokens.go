@@ -0,0 +1,162 @@
+package auth
+
+import (
+	"errors"
+	"finalp2/models"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"gorm.io/gorm"
+)
+
+const (
+	PurposeVerifyEmail    = "verify_email"
+	PurposeResetPassword  = "reset_password"
+	PurposeTwoFactorLogin = "two_factor_login"
+
+	VerifyEmailTokenTTL   = 24 * time.Hour
+	ResetPasswordTokenTTL = time.Hour
+	TwoFactorChallengeTTL = 5 * time.Minute
+)
+
+var ErrInvalidActionToken = errors.New("invalid or expired token")
+
+// ActionClaims are carried by single-use tokens such as the ones sent by email
+// or the two-factor login challenge. They are signed with the same keys as
+// access tokens but can never be used as one.
+type ActionClaims struct {
+	Purpose string `json:"purpose"`
+	// AuthMethod is how a two-factor challenge's first step signed in
+	AuthMethod string `json:"auth_method,omitempty"`
+	jwt.StandardClaims
+}
+
+// IssueActionToken creates a signed, expiring token for the given purpose.
+// Tokens issued earlier for the same user and purpose stop working.
+func IssueActionToken(db *gorm.DB, keys *KeyManager, user models.User, purpose string, ttl time.Duration) (string, error) {
+	return issueActionToken(db, keys, user, purpose, ttl, "")
+}
+
+// IssueTwoFactorChallenge issues the token that takes a login from its first
+// step, signing in with method, to the two-factor code.
+func IssueTwoFactorChallenge(db *gorm.DB, keys *KeyManager, user models.User, method string) (string, error) {
+	return issueActionToken(db, keys, user, PurposeTwoFactorLogin, TwoFactorChallengeTTL, method)
+}
+
+func issueActionToken(db *gorm.DB, keys *KeyManager, user models.User, purpose string, ttl time.Duration, method string) (string, error) {
+	tokenID, err := randomString(16)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.UserToken{}).
+			Where("user_id = ? AND purpose = ? AND used_at IS NULL", user.ID, purpose).
+			Update("used_at", now).Error; err != nil {
+			return err
+		}
+
+		return tx.Create(&models.UserToken{
+			ID:        tokenID,
+			UserID:    user.ID,
+			Purpose:   purpose,
+			ExpiresAt: now.Add(ttl),
+			CreatedAt: now,
+		}).Error
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return keys.Sign(ActionClaims{
+		Purpose:    purpose,
+		AuthMethod: method,
+		StandardClaims: jwt.StandardClaims{
+			Id:        tokenID,
+			Subject:   strconv.FormatUint(uint64(user.ID), 10),
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(ttl).Unix(),
+		},
+	})
+}
+
+// ConsumeActionToken verifies a token for the given purpose, marks it as used
+// and returns the id of the user it was issued to.
+func ConsumeActionToken(db *gorm.DB, keys *KeyManager, tokenString, purpose string) (uint, error) {
+	_, stored, err := findActionToken(db, keys, tokenString, purpose)
+	if err != nil {
+		return 0, err
+	}
+
+	// Claim the token atomically so it cannot be used twice
+	now := time.Now()
+	result := db.Model(&models.UserToken{}).
+		Where("token_id = ? AND used_at IS NULL AND expires_at > ?", stored.ID, now).
+		Update("used_at", now)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return 0, ErrInvalidActionToken
+	}
+
+	return stored.UserID, nil
+}
+
+// PruneActionTokens deletes the tokens that expired before now, used or not,
+// and returns how many there were.
+func PruneActionTokens(db *gorm.DB, now time.Time) (int64, error) {
+	result := db.Where("expires_at < ?", now).Delete(&models.UserToken{})
+	return result.RowsAffected, result.Error
+}
+
+// PeekActionToken checks a token like ConsumeActionToken but leaves it
+// unused, for flows that need to know the user before deciding to use it.
+func PeekActionToken(db *gorm.DB, keys *KeyManager, tokenString, purpose string) (uint, error) {
+	_, stored, err := peekActionToken(db, keys, tokenString, purpose)
+	return stored.UserID, err
+}
+
+// PeekTwoFactorChallenge checks a challenge like PeekActionToken and also
+// returns how its first step signed in.
+func PeekTwoFactorChallenge(db *gorm.DB, keys *KeyManager, tokenString string) (uint, string, error) {
+	claims, stored, err := peekActionToken(db, keys, tokenString, PurposeTwoFactorLogin)
+	if err != nil {
+		return 0, "", err
+	}
+	// Challenges issued before the method was recorded came from a password
+	if claims.AuthMethod == "" {
+		return stored.UserID, AuthMethodPassword, nil
+	}
+	return stored.UserID, claims.AuthMethod, nil
+}
+
+func peekActionToken(db *gorm.DB, keys *KeyManager, tokenString, purpose string) (*ActionClaims, models.UserToken, error) {
+	claims, stored, err := findActionToken(db, keys, tokenString, purpose)
+	if err != nil {
+		return nil, models.UserToken{}, err
+	}
+	if stored.UsedAt != nil || time.Now().After(stored.ExpiresAt) {
+		return nil, models.UserToken{}, ErrInvalidActionToken
+	}
+	return claims, stored, nil
+}
+
+func findActionToken(db *gorm.DB, keys *KeyManager, tokenString, purpose string) (*ActionClaims, models.UserToken, error) {
+	claims := new(ActionClaims)
+	token, err := jwt.ParseWithClaims(tokenString, claims, keys.Keyfunc)
+	if err != nil || !token.Valid || claims.Purpose != purpose || claims.Id == "" {
+		return nil, models.UserToken{}, ErrInvalidActionToken
+	}
+
+	var stored models.UserToken
+	if err := db.Where("token_id = ? AND purpose = ?", claims.Id, purpose).First(&stored).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, models.UserToken{}, ErrInvalidActionToken
+		}
+		return nil, models.UserToken{}, err
+	}
+	return claims, stored, nil
+}
@@ -0,0 +1,103 @@
+package auth
+
+import (
+	"errors"
+	"finalp2/models"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// API key scopes. A key only reaches the endpoints that accept one of its
+// scopes, and never more than its owner could.
+const (
+	ScopeCatalogRead     = "catalog:read"
+	ScopeInventoryManage = "inventory:manage"
+	ScopeReportsRead     = "reports:read"
+	ScopeMetricsRead     = "metrics:read"
+)
+
+const (
+	// APIKeyHeader carries the API key on requests made without a bearer token.
+	APIKeyHeader = "X-API-Key"
+
+	apiKeyPrefix = "bk_"
+	// Writing last_used_at on every request would be wasteful
+	apiKeyLastUsedInterval = time.Minute
+)
+
+var ErrInvalidAPIKey = errors.New("invalid, expired or revoked API key")
+
+// StaffScopes can only be granted to staff and admins.
+var StaffScopes = []string{ScopeInventoryManage, ScopeMetricsRead}
+
+// CreateAPIKey creates a key for the user. The key is returned once and only
+// its hash is kept.
+func CreateAPIKey(db *gorm.DB, userID uint, name string, scopes []string, expiresAt *time.Time) (*models.APIKey, string, error) {
+	prefix, err := randomString(6)
+	if err != nil {
+		return nil, "", err
+	}
+	secret, err := randomString(32)
+	if err != nil {
+		return nil, "", err
+	}
+	raw := apiKeyPrefix + prefix + "_" + secret
+
+	key := &models.APIKey{
+		UserID:    userID,
+		Name:      name,
+		Prefix:    apiKeyPrefix + prefix,
+		KeyHash:   hashToken(raw),
+		Scopes:    strings.Join(scopes, " "),
+		ExpiresAt: expiresAt,
+		CreatedAt: time.Now(),
+	}
+	if err := db.Create(key).Error; err != nil {
+		return nil, "", err
+	}
+	return key, raw, nil
+}
+
+// AuthenticateAPIKey looks up an active key and records that it was used.
+func AuthenticateAPIKey(db *gorm.DB, raw string) (*models.APIKey, error) {
+	if !strings.HasPrefix(raw, apiKeyPrefix) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	var key models.APIKey
+	result := db.Where("key_hash = ?", hashToken(raw)).Limit(1).Find(&key)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	now := time.Now()
+	if result.RowsAffected == 0 || key.RevokedAt != nil || (key.ExpiresAt != nil && !key.ExpiresAt.After(now)) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= apiKeyLastUsedInterval {
+		err := db.Model(&models.APIKey{}).Where("api_key_id = ?", key.ID).Update("last_used_at", now).Error
+		if err != nil {
+			return nil, err
+		}
+		key.LastUsedAt = &now
+	}
+	return &key, nil
+}
+
+// RevokeAPIKey revokes one of the user's keys. It reports false when the user
+// has no such active key.
+func RevokeAPIKey(db *gorm.DB, userID, keyID uint) (bool, error) {
+	result := db.Model(&models.APIKey{}).
+		Where("api_key_id = ? AND user_id = ? AND revoked_at IS NULL", keyID, userID).
+		Update("revoked_at", time.Now())
+	return result.RowsAffected > 0, result.Error
+}
+
+// RevokeUserAPIKeys revokes every key of the user.
+func RevokeUserAPIKeys(db *gorm.DB, userID uint) error {
+	return db.Model(&models.APIKey{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error
+}
@@ -0,0 +1,113 @@
+package auth
+
+import (
+	"errors"
+	"finalp2/models"
+	"fmt"
+	"sync"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// AttemptStore keeps the failed login counters of the login limiter.
+type AttemptStore interface {
+	// Get returns the attempts recorded for key, or a zero value when there
+	// are none.
+	Get(key string) (models.LoginAttempt, error)
+	// Update changes the attempts of key atomically, creating them if needed.
+	Update(key string, fn func(attempt *models.LoginAttempt)) error
+	// Delete forgets the attempts of key.
+	Delete(key string) error
+}
+
+// NewAttemptStore builds the store of the given kind, "database" or "memory".
+// The database store is shared by every instance of the service and is the
+// default.
+func NewAttemptStore(db *gorm.DB, kind string) (AttemptStore, error) {
+	switch kind {
+	case "", "database", "postgres":
+		return NewDBAttemptStore(db), nil
+	case "memory":
+		return NewMemoryAttemptStore(), nil
+	default:
+		return nil, fmt.Errorf("unknown login attempt store %q", kind)
+	}
+}
+
+// MemoryAttemptStore keeps attempts in process memory. It suits a single
+// instance and tests; the counters are lost on restart.
+type MemoryAttemptStore struct {
+	mu       sync.Mutex
+	attempts map[string]models.LoginAttempt
+}
+
+func NewMemoryAttemptStore() *MemoryAttemptStore {
+	return &MemoryAttemptStore{attempts: map[string]models.LoginAttempt{}}
+}
+
+func (s *MemoryAttemptStore) Get(key string) (models.LoginAttempt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	attempt, ok := s.attempts[key]
+	if !ok {
+		attempt.Key = key
+	}
+	return attempt, nil
+}
+
+func (s *MemoryAttemptStore) Update(key string, fn func(attempt *models.LoginAttempt)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	attempt := s.attempts[key]
+	attempt.Key = key
+	fn(&attempt)
+	s.attempts[key] = attempt
+	return nil
+}
+
+func (s *MemoryAttemptStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.attempts, key)
+	return nil
+}
+
+// DBAttemptStore keeps attempts in the login_attempts table.
+type DBAttemptStore struct {
+	db *gorm.DB
+}
+
+func NewDBAttemptStore(db *gorm.DB) *DBAttemptStore {
+	return &DBAttemptStore{db: db}
+}
+
+func (s *DBAttemptStore) Get(key string) (models.LoginAttempt, error) {
+	var attempt models.LoginAttempt
+	err := s.db.Where("attempt_key = ?", key).First(&attempt).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.LoginAttempt{Key: key}, nil
+	}
+	return attempt, err
+}
+
+func (s *DBAttemptStore) Update(key string, fn func(attempt *models.LoginAttempt)) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		// Make sure the row exists so concurrent failures lock the same row
+		// instead of racing to insert it
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.LoginAttempt{Key: key}).Error; err != nil {
+			return err
+		}
+
+		var attempt models.LoginAttempt
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("attempt_key = ?", key).First(&attempt).Error; err != nil {
+			return err
+		}
+		fn(&attempt)
+		return tx.Save(&attempt).Error
+	})
+}
+
+func (s *DBAttemptStore) Delete(key string) error {
+	return s.db.Where("attempt_key = ?", key).Delete(&models.LoginAttempt{}).Error
+}
@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"finalp2/models"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/labstack/echo/v4"
+)
+
+// Authentication methods listed in the amr claim (RFC 8176).
+const (
+	AuthMethodPassword  = "pwd"
+	AuthMethodFederated = "fed"
+	AuthMethodOTP       = "otp"
+)
+
+// ReauthenticationMaxAge is how long after signing in with a login provider
+// users without a password may confirm sensitive changes with that login.
+const ReauthenticationMaxAge = 10 * time.Minute
+
+// Claims are the claims carried by our access tokens.
+type Claims struct {
+	UserID      uint     `json:"user_id"`
+	Email       string   `json:"email"`
+	SessionID   string   `json:"sid"`
+	AuthMethods []string `json:"amr,omitempty"`
+	// AuthTime is when the user signed in, refreshing tokens keeps it
+	AuthTime int64 `json:"auth_time,omitempty"`
+	jwt.StandardClaims
+}
+
+// AuthenticatedWithin reports whether the session was started with method
+// less than maxAge ago.
+func (c *Claims) AuthenticatedWithin(method string, maxAge time.Duration) bool {
+	if c == nil || time.Since(time.Unix(c.AuthTime, 0)) > maxAge {
+		return false
+	}
+	for _, m := range c.AuthMethods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// TwoFactor reports whether the session was started with a second factor.
+func (c *Claims) TwoFactor() bool {
+	if c == nil {
+		return false
+	}
+	for _, method := range c.AuthMethods {
+		if method == AuthMethodOTP {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	userContextKey   = "user"
+	claimsContextKey = "claims"
+)
+
+// SetCurrentUser stores the authenticated user and the claims of their token
+// in the request context.
+func SetCurrentUser(c echo.Context, user *models.User, claims *Claims) {
+	c.Set(userContextKey, user)
+	c.Set(claimsContextKey, claims)
+}
+
+// CurrentUser returns the user loaded by the auth middleware, or nil when the
+// request is not authenticated.
+func CurrentUser(c echo.Context) *models.User {
+	user, _ := c.Get(userContextKey).(*models.User)
+	return user
+}
+
+// CurrentClaims returns the claims of the access token used for the request,
+// or nil when the request is not authenticated.
+func CurrentClaims(c echo.Context) *Claims {
+	claims, _ := c.Get(claimsContextKey).(*Claims)
+	return claims
+}
@@ -0,0 +1,237 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// KeyConfig describes one signing key. HS256 keys use Secret; RS256 and EdDSA
+// keys are read as PEM, either inline or from a file. A key with only a public
+// key can still verify tokens, which is how retired keys are kept around while
+// their tokens expire.
+type KeyConfig struct {
+	ID             string `json:"kid" yaml:"kid"`
+	Algorithm      string `json:"alg" yaml:"alg"`
+	Secret         string `json:"secret" yaml:"secret" secret:"true"`
+	PrivateKey     string `json:"private_key" yaml:"private_key" secret:"true"`
+	PrivateKeyFile string `json:"private_key_file" yaml:"private_key_file"`
+	PublicKey      string `json:"public_key" yaml:"public_key"`
+	PublicKeyFile  string `json:"public_key_file" yaml:"public_key_file"`
+}
+
+type signingKey struct {
+	id        string
+	method    jwt.SigningMethod
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+// KeyManager signs tokens with the active key and verifies tokens signed by
+// any configured key, so keys can be rotated without logging everyone out.
+type KeyManager struct {
+	active *signingKey
+	keys   map[string]*signingKey
+	order  []string
+}
+
+// NewKeyManager builds a key manager from the given keys. activeID selects the
+// key used for signing; it defaults to the first key.
+func NewKeyManager(configs []KeyConfig, activeID string) (*KeyManager, error) {
+	if len(configs) == 0 {
+		return nil, errors.New("no JWT signing keys configured")
+	}
+
+	m := &KeyManager{keys: map[string]*signingKey{}}
+	for _, cfg := range configs {
+		key, err := loadKey(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("JWT key %q: %w", cfg.ID, err)
+		}
+		if _, exists := m.keys[key.id]; exists {
+			return nil, fmt.Errorf("duplicate JWT key id %q", key.id)
+		}
+		m.keys[key.id] = key
+		m.order = append(m.order, key.id)
+	}
+
+	if activeID == "" {
+		activeID = configs[0].ID
+	}
+	active, ok := m.keys[activeID]
+	if !ok {
+		return nil, fmt.Errorf("active JWT key %q is not configured", activeID)
+	}
+	if active.signKey == nil {
+		return nil, fmt.Errorf("active JWT key %q has no private key", activeID)
+	}
+	m.active = active
+
+	return m, nil
+}
+
+// Sign signs the claims with the active key and stamps its id in the kid header.
+func (m *KeyManager) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(m.active.method, claims)
+	token.Header["kid"] = m.active.id
+	return token.SignedString(m.active.signKey)
+}
+
+// Keyfunc picks the verification key from the token's kid header and makes sure
+// the token was signed with that key's algorithm.
+func (m *KeyManager) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := m.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+	}
+	return key.verifyKey, nil
+}
+
+// JSONWebKey is the public part of a key as published in the JWKS.
+type JSONWebKey struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+}
+
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// JWKS returns the public keys other services can use to verify our tokens.
+// Symmetric keys are secret and never published.
+func (m *KeyManager) JWKS() JSONWebKeySet {
+	set := JSONWebKeySet{Keys: []JSONWebKey{}}
+	for _, id := range m.order {
+		key := m.keys[id]
+		switch pub := key.verifyKey.(type) {
+		case *rsa.PublicKey:
+			set.Keys = append(set.Keys, JSONWebKey{
+				KeyType:   "RSA",
+				KeyID:     key.id,
+				Use:       "sig",
+				Algorithm: key.method.Alg(),
+				N:         base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+				E:         base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			set.Keys = append(set.Keys, JSONWebKey{
+				KeyType:   "OKP",
+				KeyID:     key.id,
+				Use:       "sig",
+				Algorithm: key.method.Alg(),
+				Curve:     "Ed25519",
+				X:         base64.RawURLEncoding.EncodeToString(pub),
+			})
+		}
+	}
+	return set
+}
+
+func loadKey(cfg KeyConfig) (*signingKey, error) {
+	if cfg.ID == "" {
+		return nil, errors.New("kid is required")
+	}
+	key := &signingKey{id: cfg.ID}
+
+	switch cfg.Algorithm {
+	case "HS256":
+		if len(cfg.Secret) < 32 {
+			return nil, errors.New("HS256 secret must be at least 32 characters")
+		}
+		key.method = jwt.SigningMethodHS256
+		key.signKey = []byte(cfg.Secret)
+		key.verifyKey = key.signKey
+
+	case "RS256":
+		key.method = jwt.SigningMethodRS256
+		private, public, err := readPEM(cfg)
+		if err != nil {
+			return nil, err
+		}
+		if private != nil {
+			rsaKey, err := jwt.ParseRSAPrivateKeyFromPEM(private)
+			if err != nil {
+				return nil, err
+			}
+			key.signKey = rsaKey
+			key.verifyKey = &rsaKey.PublicKey
+		}
+		if public != nil {
+			rsaKey, err := jwt.ParseRSAPublicKeyFromPEM(public)
+			if err != nil {
+				return nil, err
+			}
+			key.verifyKey = rsaKey
+		}
+
+	case "EdDSA":
+		key.method = jwt.SigningMethodEdDSA
+		private, public, err := readPEM(cfg)
+		if err != nil {
+			return nil, err
+		}
+		if private != nil {
+			edKey, err := jwt.ParseEdPrivateKeyFromPEM(private)
+			if err != nil {
+				return nil, err
+			}
+			priv, ok := edKey.(ed25519.PrivateKey)
+			if !ok {
+				return nil, errors.New("private key is not an Ed25519 key")
+			}
+			key.signKey = priv
+			key.verifyKey = priv.Public()
+		}
+		if public != nil {
+			edKey, err := jwt.ParseEdPublicKeyFromPEM(public)
+			if err != nil {
+				return nil, err
+			}
+			key.verifyKey = edKey
+		}
+
+	default:
+		return nil, fmt.Errorf("unsupported algorithm %q", cfg.Algorithm)
+	}
+
+	if key.verifyKey == nil {
+		return nil, errors.New("a private or public key is required")
+	}
+	return key, nil
+}
+
+func readPEM(cfg KeyConfig) (private, public []byte, err error) {
+	read := func(inline, file string) ([]byte, error) {
+		if inline != "" {
+			return []byte(inline), nil
+		}
+		if file != "" {
+			return os.ReadFile(file)
+		}
+		return nil, nil
+	}
+
+	if private, err = read(cfg.PrivateKey, cfg.PrivateKeyFile); err != nil {
+		return nil, nil, err
+	}
+	if public, err = read(cfg.PublicKey, cfg.PublicKeyFile); err != nil {
+		return nil, nil, err
+	}
+	return private, public, nil
+}
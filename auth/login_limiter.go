@@ -0,0 +1,147 @@
+package auth
+
+import (
+	"finalp2/models"
+	"net"
+	"strings"
+	"time"
+)
+
+// LimitPolicy describes how quickly failed logins slow a key down. The first
+// FreeAttempts failures cost nothing; each further failure blocks the key for
+// BaseDelay, doubling every time up to MaxDelay. After LockoutAfter failures
+// the key is locked for LockoutDuration. Failures are forgotten once the key
+// has been quiet for ResetAfter.
+type LimitPolicy struct {
+	FreeAttempts    int
+	BaseDelay       time.Duration
+	MaxDelay        time.Duration
+	LockoutAfter    int
+	LockoutDuration time.Duration
+	ResetAfter      time.Duration
+}
+
+var (
+	DefaultAccountPolicy = LimitPolicy{
+		FreeAttempts:    3,
+		BaseDelay:       2 * time.Second,
+		MaxDelay:        5 * time.Minute,
+		LockoutAfter:    10,
+		LockoutDuration: 30 * time.Minute,
+		ResetAfter:      time.Hour,
+	}
+	// Several users can share an address behind a NAT, so IPs get more room
+	DefaultIPPolicy = LimitPolicy{
+		FreeAttempts:    10,
+		BaseDelay:       time.Second,
+		MaxDelay:        5 * time.Minute,
+		LockoutAfter:    50,
+		LockoutDuration: time.Hour,
+		ResetAfter:      time.Hour,
+	}
+)
+
+// blockFor returns how long a key is blocked after its nth failure.
+func (p LimitPolicy) blockFor(failures int) time.Duration {
+	if p.LockoutAfter > 0 && failures >= p.LockoutAfter {
+		return p.LockoutDuration
+	}
+	if failures <= p.FreeAttempts {
+		return 0
+	}
+	delay := p.BaseDelay
+	for i := p.FreeAttempts + 1; i < failures && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	return delay
+}
+
+// LoginLimiter slows down password guessing by tracking failed logins per
+// account and per client IP.
+type LoginLimiter struct {
+	store   AttemptStore
+	Account LimitPolicy
+	IP      LimitPolicy
+	now     func() time.Time
+}
+
+func NewLoginLimiter(store AttemptStore) *LoginLimiter {
+	return &LoginLimiter{
+		store:   store,
+		Account: DefaultAccountPolicy,
+		IP:      DefaultIPPolicy,
+		now:     time.Now,
+	}
+}
+
+// RetryAfter returns how long the client has to wait before it may try to log
+// in to the account again. Zero means it may try now.
+func (l *LoginLimiter) RetryAfter(email, ip string) (time.Duration, error) {
+	var wait time.Duration
+	for _, key := range []string{accountKey(email), ipKey(ip)} {
+		attempt, err := l.store.Get(key)
+		if err != nil {
+			return 0, err
+		}
+		if attempt.BlockedUntil != nil {
+			if remaining := attempt.BlockedUntil.Sub(l.now()); remaining > wait {
+				wait = remaining
+			}
+		}
+	}
+	return wait, nil
+}
+
+// RecordFailure counts a failed login against the account and the IP.
+func (l *LoginLimiter) RecordFailure(email, ip string) error {
+	if err := l.fail(accountKey(email), l.Account); err != nil {
+		return err
+	}
+	return l.fail(ipKey(ip), l.IP)
+}
+
+// RecordSuccess clears the failures of the account. The IP keeps its count so
+// logging in to one's own account does not reset guessing at others.
+func (l *LoginLimiter) RecordSuccess(email string) error {
+	return l.store.Delete(accountKey(email))
+}
+
+// Unlock clears the failures and lockout of an account.
+func (l *LoginLimiter) Unlock(email string) error {
+	return l.store.Delete(accountKey(email))
+}
+
+// UnlockIP clears the failures and lockout of a client IP.
+func (l *LoginLimiter) UnlockIP(ip string) error {
+	return l.store.Delete(ipKey(ip))
+}
+
+func (l *LoginLimiter) fail(key string, policy LimitPolicy) error {
+	now := l.now()
+	return l.store.Update(key, func(attempt *models.LoginAttempt) {
+		if policy.ResetAfter > 0 && now.Sub(attempt.LastFailureAt) > policy.ResetAfter {
+			attempt.Failures = 0
+			attempt.BlockedUntil = nil
+		}
+		attempt.Failures++
+		attempt.LastFailureAt = now
+		if block := policy.blockFor(attempt.Failures); block > 0 {
+			until := now.Add(block)
+			attempt.BlockedUntil = &until
+		}
+	})
+}
+
+func accountKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipKey(ip string) string {
+	if parsed := net.ParseIP(ip); parsed != nil {
+		ip = parsed.String()
+	}
+	return "ip:" + ip
+}
@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+const (
+	purposeOIDCState = "oidc_state"
+
+	// OIDCStateTTL is how long the user has to finish logging in at the
+	// identity provider.
+	OIDCStateTTL = 10 * time.Minute
+)
+
+var ErrInvalidOIDCState = errors.New("invalid or expired login state")
+
+// OIDCState is what the callback needs to finish a social login. It is signed
+// and handed to the browser in a cookie, so nothing is stored server side.
+type OIDCState struct {
+	Purpose  string `json:"purpose"`
+	Provider string `json:"provider"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	jwt.StandardClaims
+}
+
+// NewOIDCState creates the state, nonce and PKCE verifier for a login with
+// the provider and returns them signed.
+func NewOIDCState(keys *KeyManager, provider, verifier string) (*OIDCState, string, error) {
+	state, err := randomString(16)
+	if err != nil {
+		return nil, "", err
+	}
+	nonce, err := randomString(16)
+	if err != nil {
+		return nil, "", err
+	}
+
+	now := time.Now()
+	claims := &OIDCState{
+		Purpose:  purposeOIDCState,
+		Provider: provider,
+		Nonce:    nonce,
+		Verifier: verifier,
+		StandardClaims: jwt.StandardClaims{
+			Id:        state,
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(OIDCStateTTL).Unix(),
+		},
+	}
+	signed, err := keys.Sign(claims)
+	if err != nil {
+		return nil, "", err
+	}
+	return claims, signed, nil
+}
+
+// ParseOIDCState verifies a signed state for the provider and checks that it
+// belongs to the state parameter the provider sent back.
+func ParseOIDCState(keys *KeyManager, signed, provider, state string) (*OIDCState, error) {
+	claims := new(OIDCState)
+	token, err := jwt.ParseWithClaims(signed, claims, keys.Keyfunc)
+	if err != nil || !token.Valid || claims.Purpose != purposeOIDCState {
+		return nil, ErrInvalidOIDCState
+	}
+	if claims.Provider != provider || claims.Id == "" || claims.Id != state {
+		return nil, ErrInvalidOIDCState
+	}
+	return claims, nil
+}
@@ -0,0 +1,247 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"finalp2/models"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"gorm.io/gorm"
+)
+
+const (
+	AccessTokenTTL  = 15 * time.Minute
+	RefreshTokenTTL = 30 * 24 * time.Hour
+)
+
+var (
+	ErrInvalidToken        = errors.New("invalid token")
+	ErrSessionRevoked      = errors.New("session revoked")
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reused")
+)
+
+// TokenPair is handed to the client after login or refresh.
+type TokenPair struct {
+	AccessToken  string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
+// IssueTokens starts a new session for the user and returns its first token
+// pair. method is the first factor the user signed in with, such as
+// AuthMethodPassword, and twoFactor records that they also passed a second.
+func IssueTokens(db *gorm.DB, keys *KeyManager, user models.User, method string, twoFactor bool) (*TokenPair, error) {
+	sessionID, err := randomString(16)
+	if err != nil {
+		return nil, err
+	}
+
+	var pair *TokenPair
+	err = db.Transaction(func(tx *gorm.DB) error {
+		session := models.Session{
+			ID:         sessionID,
+			UserID:     user.ID,
+			AuthMethod: method,
+			TwoFactor:  twoFactor,
+			CreatedAt:  time.Now(),
+		}
+		if err := tx.Create(&session).Error; err != nil {
+			return err
+		}
+
+		pair, err = issuePair(tx, keys, user, session)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return pair, nil
+}
+
+// RefreshTokens exchanges a refresh token for a new token pair. Every refresh
+// token can be used once; presenting one that was already used means it was
+// stolen, so the whole session is revoked.
+func RefreshTokens(db *gorm.DB, keys *KeyManager, refreshToken string) (*TokenPair, error) {
+	var pair *TokenPair
+	var reused bool
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var stored models.RefreshToken
+		if err := tx.Where("token_hash = ?", hashToken(refreshToken)).First(&stored).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrInvalidRefreshToken
+			}
+			return err
+		}
+
+		var session models.Session
+		if err := tx.Where("session_id = ?", stored.SessionID).First(&session).Error; err != nil {
+			return err
+		}
+		if session.RevokedAt != nil {
+			return ErrSessionRevoked
+		}
+
+		now := time.Now()
+		if stored.UsedAt != nil {
+			reused = true
+			return nil
+		}
+		if now.After(stored.ExpiresAt) {
+			return ErrInvalidRefreshToken
+		}
+
+		// Rotate: the presented token can never be used again
+		result := tx.Model(&models.RefreshToken{}).Where("refresh_token_id = ? AND used_at IS NULL", stored.ID).Update("used_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			reused = true
+			return nil
+		}
+
+		var user models.User
+		if err := tx.Where("user_id = ?", session.UserID).First(&user).Error; err != nil {
+			return err
+		}
+
+		var err error
+		pair, err = issuePair(tx, keys, user, session)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if reused {
+		var stored models.RefreshToken
+		if err := db.Where("token_hash = ?", hashToken(refreshToken)).First(&stored).Error; err != nil {
+			return nil, err
+		}
+		if err := RevokeSession(db, stored.SessionID); err != nil {
+			return nil, err
+		}
+		return nil, ErrRefreshTokenReused
+	}
+
+	return pair, nil
+}
+
+// RevokeSession ends a session. Its refresh tokens stop working immediately and
+// access tokens issued for it are rejected by the auth middleware.
+func RevokeSession(db *gorm.DB, sessionID string) error {
+	return db.Model(&models.Session{}).
+		Where("session_id = ? AND revoked_at IS NULL", sessionID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// ParseAccessToken validates the signature and expiry of an access token and
+// checks that its session has not been revoked.
+func ParseAccessToken(db *gorm.DB, keys *KeyManager, tokenString string) (*Claims, error) {
+	claims := new(Claims)
+	token, err := jwt.ParseWithClaims(tokenString, claims, keys.Keyfunc)
+	if err != nil || !token.Valid {
+		return nil, ErrInvalidToken
+	}
+	if claims.UserID == 0 || claims.SessionID == "" {
+		return nil, ErrInvalidToken
+	}
+
+	var active int64
+	if err := db.Model(&models.Session{}).Where("session_id = ? AND revoked_at IS NULL", claims.SessionID).Count(&active).Error; err != nil {
+		return nil, err
+	}
+	if active == 0 {
+		return nil, ErrSessionRevoked
+	}
+
+	return claims, nil
+}
+
+func issuePair(db *gorm.DB, keys *KeyManager, user models.User, session models.Session) (*TokenPair, error) {
+	now := time.Now()
+
+	tokenID, err := randomString(16)
+	if err != nil {
+		return nil, err
+	}
+	methods := []string{session.AuthMethod}
+	if session.TwoFactor {
+		methods = append(methods, AuthMethodOTP)
+	}
+	claims := Claims{
+		UserID:      user.ID,
+		Email:       user.Email,
+		SessionID:   session.ID,
+		AuthMethods: methods,
+		AuthTime:    session.CreatedAt.Unix(),
+		StandardClaims: jwt.StandardClaims{
+			Id:        tokenID,
+			Subject:   strconv.FormatUint(uint64(user.ID), 10),
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(AccessTokenTTL).Unix(),
+		},
+	}
+	accessToken, err := keys.Sign(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := randomString(32)
+	if err != nil {
+		return nil, err
+	}
+	stored := models.RefreshToken{
+		SessionID: session.ID,
+		TokenHash: hashToken(refreshToken),
+		ExpiresAt: now.Add(RefreshTokenTTL),
+		CreatedAt: now,
+	}
+	if err := db.Create(&stored).Error; err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(AccessTokenTTL.Seconds()),
+	}, nil
+}
+
+// Refresh tokens are only stored as hashes so a leaked table cannot be replayed.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// RevokeUserSessions ends every session of the user, e.g. after a password change.
+func RevokeUserSessions(db *gorm.DB, userID uint) error {
+	return db.Model(&models.Session{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// RevokeOtherSessions ends every session of the user except the given one, so
+// the device that made the change stays logged in.
+func RevokeOtherSessions(db *gorm.DB, userID uint, keepSessionID string) error {
+	return db.Model(&models.Session{}).
+		Where("user_id = ? AND session_id <> ? AND revoked_at IS NULL", userID, keepSessionID).
+		Update("revoked_at", time.Now()).Error
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"finalp2/auth"
+	"finalp2/middlewares"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// cleanupInterval is how often pruneExpired runs.
+const cleanupInterval = time.Hour
+
+// pruneExpired deletes the idempotency keys and single-use tokens that can't
+// be used anymore, once right away and then every interval until ctx is done.
+// Failures are only logged, the next round tries again.
+func pruneExpired(ctx context.Context, db *gorm.DB, interval time.Duration) {
+	prunes := []struct {
+		what  string
+		prune func(db *gorm.DB, now time.Time) (int64, error)
+	}{
+		{"idempotency keys", middlewares.PruneIdempotencyKeys},
+		{"email and two-factor tokens", auth.PruneActionTokens},
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		now := time.Now()
+		for _, p := range prunes {
+			deleted, err := p.prune(db.WithContext(ctx), now)
+			switch {
+			case err != nil && ctx.Err() == nil:
+				log.Printf("Failed to delete expired %s: %v", p.what, err)
+			case deleted > 0:
+				log.Printf("Deleted %d expired %s", deleted, p.what)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"finalp2/models"
+	"finalp2/routes/routestest"
+)
+
+// eventually fails the test unless cond holds within a few seconds.
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); !cond(); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("%s did not happen", what)
+		}
+	}
+}
+
+func TestPruneExpired(t *testing.T) {
+	app := routestest.New(t)
+	user := app.User(t, routestest.UserEmail)
+	now := time.Now()
+	rows := []interface{}{
+		&models.IdempotencyKey{UserID: user.ID, Key: "forgotten", CreatedAt: now.Add(-25 * time.Hour)},
+		&models.IdempotencyKey{UserID: user.ID, Key: "recent", CreatedAt: now},
+		&models.UserToken{ID: "expired", UserID: user.ID, Purpose: "verify_email", ExpiresAt: now.Add(-time.Minute), CreatedAt: now.Add(-time.Hour)},
+		&models.UserToken{ID: "valid", UserID: user.ID, Purpose: "verify_email", ExpiresAt: now.Add(time.Hour), CreatedAt: now},
+	}
+	for _, row := range rows {
+		if err := app.DB.Create(row).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	left := func(model interface{}, column string) []string {
+		var values []string
+		if err := app.DB.Model(model).Order(column).Pluck(column, &values).Error; err != nil {
+			t.Fatal(err)
+		}
+		return values
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		pruneExpired(ctx, app.DB, 20*time.Millisecond)
+		close(stopped)
+	}()
+
+	eventually(t, "the first cleanup", func() bool {
+		return len(left(&models.IdempotencyKey{}, "idempotency_key")) == 1 && len(left(&models.UserToken{}, "token_id")) == 1
+	})
+	if keys, tokens := left(&models.IdempotencyKey{}, "idempotency_key"), left(&models.UserToken{}, "token_id"); keys[0] != "recent" || tokens[0] != "valid" {
+		t.Fatalf("kept keys %v and tokens %v", keys, tokens)
+	}
+
+	// Later rounds catch what expired since
+	err := app.DB.Model(&models.UserToken{}).Where("token_id = ?", "valid").Update("expires_at", now.Add(-time.Second)).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, "the next cleanup", func() bool {
+		return len(left(&models.UserToken{}, "token_id")) == 0
+	})
+
+	cancel()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("cleanup did not stop")
+	}
+}
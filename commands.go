@@ -0,0 +1,156 @@
+package main
+
+import (
+	"errors"
+	"finalp2/config"
+	"finalp2/migrations"
+	"finalp2/seeds"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const usage = `usage:
+  go run .                      start the server
+  go run . migrate up           apply every pending migration
+  go run . migrate down [steps] roll back the last steps migrations (default 1)
+  go run . migrate status       list the migrations and when they were applied
+  go run . seed [env|file]      load the fixtures of an environment (default
+                                APP_ENV) or a YAML or JSON file`
+
+// runCommand runs the subcommand named by args, the command line without the
+// program name.
+func runCommand(cfg *config.Config, db *gorm.DB, args []string) error {
+	switch args[0] {
+	case "migrate":
+		return runMigrate(db, args[1:])
+	case "seed":
+		return runSeed(cfg, db, args[1:])
+	default:
+		return fmt.Errorf("unknown command %q\n%s", args[0], usage)
+	}
+}
+
+func runMigrate(db *gorm.DB, args []string) error {
+	if len(args) == 0 {
+		return errors.New(usage)
+	}
+
+	migrator, err := migrations.New(db)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up()
+		for _, migration := range applied {
+			fmt.Printf("applied %d_%s\n", migration.Version, migration.Name)
+		}
+		if err == nil && len(applied) == 0 {
+			fmt.Println("already up to date")
+		}
+		return err
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				return fmt.Errorf("steps must be a positive number, got %q", args[1])
+			}
+		}
+		rolledBack, err := migrator.Down(steps)
+		for _, migration := range rolledBack {
+			fmt.Printf("rolled back %d_%s\n", migration.Version, migration.Name)
+		}
+		return err
+
+	case "status":
+		statuses, err := migrator.Status()
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		for _, status := range statuses {
+			appliedAt := "pending"
+			if status.AppliedAt != nil {
+				appliedAt = status.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\n", status.Version, status.Name, appliedAt)
+		}
+		return w.Flush()
+
+	default:
+		return fmt.Errorf("unknown migrate command %q\n%s", args[0], usage)
+	}
+}
+
+func runSeed(cfg *config.Config, db *gorm.DB, args []string) error {
+	name := cfg.Server.Environment
+	if len(args) > 0 {
+		name = args[0]
+	}
+
+	fixtures, err := seeds.Load(name)
+	if err != nil {
+		return err
+	}
+	hasher, err := cfg.Password.Hasher()
+	if err != nil {
+		return err
+	}
+
+	result, err := seeds.Seed(db, hasher, fixtures)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "\tCREATED\tEXISTING")
+	for _, row := range []struct {
+		name  string
+		count seeds.Count
+	}{
+		{"authors", result.Authors},
+		{"categories", result.Categories},
+		{"books", result.Books},
+		{"copies", result.Copies},
+		{"users", result.Users},
+	} {
+		fmt.Fprintf(w, "%s\t%d\t%d\n", row.name, row.count.Created, row.count.Existing)
+	}
+	return w.Flush()
+}
+
+// migrateOnStart applies pending migrations when the config asks for it and
+// otherwise only warns about them.
+func migrateOnStart(db *gorm.DB, enabled bool) error {
+	migrator, err := migrations.New(db)
+	if err != nil {
+		return err
+	}
+
+	if !enabled {
+		pending, err := migrator.Pending()
+		if err != nil {
+			return err
+		}
+		if pending > 0 {
+			log.Printf("%d database migrations are pending, run \"go run . migrate up\" or set DB_MIGRATE_ON_START", pending)
+		}
+		return nil
+	}
+
+	applied, err := migrator.Up()
+	for _, migration := range applied {
+		log.Printf("Applied migration %d_%s", migration.Version, migration.Name)
+	}
+	return err
+}
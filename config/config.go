@@ -0,0 +1,435 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"finalp2/auth"
+	"finalp2/oidc"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/joho/godotenv"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the whole service configuration. Each value is resolved from, in
+// increasing order of precedence: the defaults, the YAML file, the .env file
+// and the process environment. The env tag names the variable that sets a
+// field; lists are given as JSON. Fields tagged secret are redacted when the
+// config is printed.
+type Config struct {
+	Server   ServerConfig   `yaml:"server"`
+	Database DatabaseConfig `yaml:"database"`
+	JWT      JWTConfig      `yaml:"jwt"`
+	Auth     AuthConfig     `yaml:"auth"`
+	Password PasswordConfig `yaml:"password"`
+	Mail     MailConfig     `yaml:"mail"`
+	Xendit   XenditConfig   `yaml:"xendit"`
+	Log      LogConfig      `yaml:"log"`
+}
+
+type ServerConfig struct {
+	Port string `yaml:"port" env:"PORT"`
+	// AppURL is the base URL used for links in emails.
+	AppURL string `yaml:"app_url" env:"APP_URL"`
+	// Environment picks the fixtures loaded by the seed command.
+	Environment string `yaml:"environment" env:"APP_ENV"`
+	// DrainDelay is how long the server keeps taking requests after it is
+	// asked to stop, while /readyz fails, so load balancers stop sending it
+	// traffic first. ShutdownTimeout is how long in-flight requests then may
+	// take to finish.
+	DrainDelay      time.Duration `yaml:"drain_delay" env:"DRAIN_DELAY"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT"`
+	// TrustedProxies are the CIDR ranges of the load balancers in front of
+	// the server. Only requests from them may name the client in
+	// X-Forwarded-For; without any, the address of the connection is used.
+	TrustedProxies []string `yaml:"trusted_proxies" env:"TRUSTED_PROXIES"`
+}
+
+// TrustedProxyRanges parses TrustedProxies.
+func (s ServerConfig) TrustedProxyRanges() ([]*net.IPNet, error) {
+	ranges := make([]*net.IPNet, 0, len(s.TrustedProxies))
+	for _, cidr := range s.TrustedProxies {
+		_, ipRange, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		ranges = append(ranges, ipRange)
+	}
+	return ranges, nil
+}
+
+// DatabaseConfig selects the database. Driver is "postgres", which connects
+// with Host, Port and the other connection settings, or "sqlite", which opens
+// the file at Path, or an in-memory database when Path is ":memory:".
+type DatabaseConfig struct {
+	Driver   string `yaml:"driver" env:"DB_DRIVER"`
+	Path     string `yaml:"path" env:"DB_PATH"`
+	Host     string `yaml:"host" env:"DB_HOST"`
+	Port     string `yaml:"port" env:"DB_PORT"`
+	User     string `yaml:"user" env:"DB_USER"`
+	Password string `yaml:"password" env:"DB_PASSWORD" secret:"true"`
+	Name     string `yaml:"name" env:"DB_NAME"`
+	SSLMode  string `yaml:"sslmode" env:"DB_SSLMODE"`
+	TimeZone string `yaml:"timezone" env:"DB_TIMEZONE"`
+	// MigrateOnStart applies pending migrations when the server starts.
+	MigrateOnStart bool `yaml:"migrate_on_start" env:"DB_MIGRATE_ON_START"`
+
+	// Connection pool settings, as in database/sql. Zero leaves the number of
+	// open connections and their lifetime unlimited, but keeps no connection
+	// idle.
+	MaxOpenConns    int           `yaml:"max_open_conns" env:"DB_MAX_OPEN_CONNS"`
+	MaxIdleConns    int           `yaml:"max_idle_conns" env:"DB_MAX_IDLE_CONNS"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime" env:"DB_CONN_MAX_LIFETIME"`
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time" env:"DB_CONN_MAX_IDLE_TIME"`
+	// ConnectAttempts is how often connecting is tried at startup. The first
+	// retry waits ConnectBackoff, every further one twice as long.
+	ConnectAttempts int           `yaml:"connect_attempts" env:"DB_CONNECT_ATTEMPTS"`
+	ConnectBackoff  time.Duration `yaml:"connect_backoff" env:"DB_CONNECT_BACKOFF"`
+	// QueryTimeout cancels the queries of a request that takes longer; zero
+	// disables it.
+	QueryTimeout time.Duration `yaml:"query_timeout" env:"DB_QUERY_TIMEOUT"`
+}
+
+// JWTConfig holds the token signing keys. Secret adds an HS256 key with the
+// id SecretKID; ActiveKID picks the key used for signing, the others are only
+// used for verification.
+type JWTConfig struct {
+	Keys      []auth.KeyConfig `yaml:"keys" env:"JWT_KEYS"`
+	Secret    string           `yaml:"secret" env:"JWT_SECRET" secret:"true"`
+	SecretKID string           `yaml:"secret_kid" env:"JWT_SECRET_KID"`
+	ActiveKID string           `yaml:"active_kid" env:"JWT_ACTIVE_KID"`
+}
+
+type AuthConfig struct {
+	// RequireEmailVerification blocks login until the user verified their email.
+	RequireEmailVerification bool `yaml:"require_email_verification" env:"REQUIRE_EMAIL_VERIFICATION"`
+	// LoginAttemptStore is "database" (shared by every instance) or "memory".
+	// "postgres" is accepted for "database".
+	LoginAttemptStore string                `yaml:"login_attempt_store" env:"LOGIN_ATTEMPT_STORE"`
+	OIDCProviders     []oidc.ProviderConfig `yaml:"oidc_providers" env:"OIDC_PROVIDERS"`
+}
+
+// PasswordConfig selects how new passwords are hashed. Stored passwords are
+// rehashed on login when these change.
+type PasswordConfig struct {
+	Algorithm         string `yaml:"algorithm" env:"PASSWORD_HASH_ALGORITHM"`
+	BcryptCost        int    `yaml:"bcrypt_cost" env:"PASSWORD_BCRYPT_COST"`
+	Argon2Memory      uint32 `yaml:"argon2_memory" env:"PASSWORD_ARGON2_MEMORY"`
+	Argon2Iterations  uint32 `yaml:"argon2_iterations" env:"PASSWORD_ARGON2_ITERATIONS"`
+	Argon2Parallelism uint8  `yaml:"argon2_parallelism" env:"PASSWORD_ARGON2_PARALLELISM"`
+}
+
+// MailConfig selects the mailer, "smtp" or "memory". The SMTP defaults point
+// at a MailHog instance on localhost:1025.
+type MailConfig struct {
+	Driver       string `yaml:"driver" env:"MAIL_DRIVER"`
+	SMTPHost     string `yaml:"smtp_host" env:"SMTP_HOST"`
+	SMTPPort     string `yaml:"smtp_port" env:"SMTP_PORT"`
+	SMTPUsername string `yaml:"smtp_username" env:"SMTP_USERNAME"`
+	SMTPPassword string `yaml:"smtp_password" env:"SMTP_PASSWORD" secret:"true"`
+	From         string `yaml:"from" env:"MAIL_FROM"`
+}
+
+type XenditConfig struct {
+	APIKey string `yaml:"api_key" env:"XENDIT_API_KEY" secret:"true"`
+	// APIURL points invoices at another server than the Xendit API, e.g. a
+	// fake. The readiness check only probes the gateway when it is set.
+	APIURL string `yaml:"api_url" env:"XENDIT_API_URL"`
+}
+
+type LogConfig struct {
+	File  string `yaml:"file" env:"LOG_FILE"`
+	Level string `yaml:"level" env:"LOG_LEVEL"`
+}
+
+const redacted = "[redacted]"
+
+// Default returns the configuration used for anything left unset.
+func Default() Config {
+	return Config{
+		Server: ServerConfig{
+			Port:        "8080",
+			AppURL:      "http://localhost:8080",
+			Environment: "development",
+
+			DrainDelay:      5 * time.Second,
+			ShutdownTimeout: 20 * time.Second,
+		},
+		Database: DatabaseConfig{
+			Driver:   "postgres",
+			Path:     "library.db",
+			Port:     "5432",
+			SSLMode:  "disable",
+			TimeZone: "Asia/Jakarta",
+
+			MaxOpenConns:    10,
+			MaxIdleConns:    5,
+			ConnMaxLifetime: 30 * time.Minute,
+			ConnMaxIdleTime: 5 * time.Minute,
+			ConnectAttempts: 5,
+			ConnectBackoff:  time.Second,
+			QueryTimeout:    10 * time.Second,
+		},
+		JWT: JWTConfig{
+			SecretKID: "hs256",
+		},
+		Auth: AuthConfig{
+			LoginAttemptStore: "database",
+		},
+		Password: PasswordConfig{
+			Algorithm:         auth.HashBcrypt,
+			BcryptCost:        auth.DefaultBcryptCost,
+			Argon2Memory:      auth.DefaultArgon2Params.Memory,
+			Argon2Iterations:  auth.DefaultArgon2Params.Iterations,
+			Argon2Parallelism: auth.DefaultArgon2Params.Parallelism,
+		},
+		Mail: MailConfig{
+			Driver:   "smtp",
+			SMTPHost: "localhost",
+			SMTPPort: "1025",
+			From:     "Book Rental <no-reply@bookrental.local>",
+		},
+		Log: LogConfig{
+			File:  "app.log",
+			Level: "warn",
+		},
+	}
+}
+
+// Load reads the configuration and validates it. The YAML file is taken from
+// CONFIG_FILE, or config.yaml when that exists; .env is optional too.
+func Load() (*Config, error) {
+	// godotenv never overrides variables that are already set, which keeps
+	// .env below the real environment
+	if err := godotenv.Load(); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("loading .env: %w", err)
+	}
+
+	cfg := Default()
+
+	path, explicit := os.LookupEnv("CONFIG_FILE")
+	if !explicit {
+		path = "config.yaml"
+	}
+	raw, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		if err := yaml.Unmarshal(raw, &cfg); err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", path, err)
+		}
+	case explicit || !errors.Is(err, fs.ErrNotExist):
+		return nil, fmt.Errorf("reading config file: %w", err)
+	}
+
+	if err := applyEnv(reflect.ValueOf(&cfg).Elem()); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// Validate checks that the required values are set and the choices are known.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	port, err := strconv.Atoi(c.Server.Port)
+	check(err == nil && port > 0 && port < 65536, "PORT must be a port number, got %q", c.Server.Port)
+	check(c.Server.AppURL != "", "APP_URL is required")
+	check(c.Server.DrainDelay >= 0, "DRAIN_DELAY must not be negative")
+	check(c.Server.ShutdownTimeout > 0, "SHUTDOWN_TIMEOUT must be positive")
+	_, err = c.Server.TrustedProxyRanges()
+	check(err == nil, "TRUSTED_PROXIES must be CIDR ranges: %v", err)
+
+	switch c.Database.Driver {
+	case "postgres":
+		check(c.Database.Host != "", "DB_HOST is required")
+		check(c.Database.User != "", "DB_USER is required")
+		check(c.Database.Name != "", "DB_NAME is required")
+	case "sqlite":
+		check(c.Database.Path != "", "DB_PATH is required")
+	default:
+		check(false, "DB_DRIVER must be postgres or sqlite, got %q", c.Database.Driver)
+	}
+	check(c.Database.MaxOpenConns >= 0, "DB_MAX_OPEN_CONNS must not be negative")
+	check(c.Database.MaxIdleConns >= 0, "DB_MAX_IDLE_CONNS must not be negative")
+	check(c.Database.ConnMaxLifetime >= 0, "DB_CONN_MAX_LIFETIME must not be negative")
+	check(c.Database.ConnMaxIdleTime >= 0, "DB_CONN_MAX_IDLE_TIME must not be negative")
+	check(c.Database.ConnectAttempts >= 1, "DB_CONNECT_ATTEMPTS must be at least 1")
+	check(c.Database.ConnectBackoff >= 0, "DB_CONNECT_BACKOFF must not be negative")
+	check(c.Database.QueryTimeout >= 0, "DB_QUERY_TIMEOUT must not be negative")
+
+	check(len(c.JWT.Keys) > 0 || c.JWT.Secret != "", "JWT_SECRET or JWT_KEYS is required")
+
+	switch c.Auth.LoginAttemptStore {
+	case "database", "postgres", "memory":
+	default:
+		check(false, "LOGIN_ATTEMPT_STORE must be database or memory, got %q", c.Auth.LoginAttemptStore)
+	}
+	check(c.Password.Algorithm == auth.HashBcrypt || c.Password.Algorithm == auth.HashArgon2id,
+		"PASSWORD_HASH_ALGORITHM must be bcrypt or argon2id, got %q", c.Password.Algorithm)
+	check(c.Mail.Driver == "smtp" || c.Mail.Driver == "memory", "MAIL_DRIVER must be smtp or memory, got %q", c.Mail.Driver)
+
+	check(c.Xendit.APIKey != "", "XENDIT_API_KEY is required")
+
+	_, err = logrus.ParseLevel(c.Log.Level)
+	check(err == nil, "LOG_LEVEL %q is not a log level", c.Log.Level)
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// Redacted returns a copy of the configuration with secrets masked.
+func (c Config) Redacted() Config {
+	redact(reflect.ValueOf(&c).Elem())
+	return c
+}
+
+// String prints the configuration as YAML without its secrets.
+func (c Config) String() string {
+	out, err := yaml.Marshal(c.Redacted())
+	if err != nil {
+		return fmt.Sprintf("config: %v", err)
+	}
+	return string(out)
+}
+
+// KeyConfigs returns the signing keys, including the one from Secret.
+func (c JWTConfig) KeyConfigs() []auth.KeyConfig {
+	keys := append([]auth.KeyConfig{}, c.Keys...)
+	if c.Secret != "" {
+		keys = append(keys, auth.KeyConfig{ID: c.SecretKID, Algorithm: "HS256", Secret: c.Secret})
+	}
+	return keys
+}
+
+// Hasher builds the password hasher.
+func (c PasswordConfig) Hasher() (*auth.PasswordHasher, error) {
+	hasher := &auth.PasswordHasher{
+		Algorithm:  c.Algorithm,
+		BcryptCost: c.BcryptCost,
+		Argon2:     auth.DefaultArgon2Params,
+	}
+	hasher.Argon2.Memory = c.Argon2Memory
+	hasher.Argon2.Iterations = c.Argon2Iterations
+	hasher.Argon2.Parallelism = c.Argon2Parallelism
+	if err := hasher.Validate(); err != nil {
+		return nil, err
+	}
+	return hasher, nil
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// applyEnv sets every field with an env tag whose variable is set.
+func applyEnv(v reflect.Value) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field, value := t.Field(i), v.Field(i)
+		if field.Type.Kind() == reflect.Struct {
+			if err := applyEnv(value); err != nil {
+				return err
+			}
+			continue
+		}
+
+		name := field.Tag.Get("env")
+		if name == "" {
+			continue
+		}
+		raw, ok := os.LookupEnv(name)
+		if !ok || raw == "" {
+			continue
+		}
+		if err := setValue(value, raw); err != nil {
+			return fmt.Errorf("invalid %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func setValue(v reflect.Value, raw string) error {
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(raw, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Slice:
+		return json.Unmarshal([]byte(raw), v.Addr().Interface())
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+// redact masks the secret fields in v. Slices are copied first so the
+// original config keeps its values.
+func redact(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field, value := t.Field(i), v.Field(i)
+			if !value.CanSet() {
+				continue
+			}
+			if field.Tag.Get("secret") == "true" && value.Kind() == reflect.String {
+				if value.String() != "" {
+					value.SetString(redacted)
+				}
+				continue
+			}
+			redact(value)
+		}
+	case reflect.Slice:
+		if v.IsNil() {
+			return
+		}
+		copied := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		reflect.Copy(copied, v)
+		for i := 0; i < copied.Len(); i++ {
+			redact(copied.Index(i))
+		}
+		v.Set(copied)
+	}
+}
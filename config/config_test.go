@@ -0,0 +1,24 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateRequiresSigningKey(t *testing.T) {
+	cfg := Default()
+	cfg.Database.Host = "localhost"
+	cfg.Database.User = "postgres"
+	cfg.Database.Name = "library"
+	cfg.Xendit.APIKey = "xnd_test"
+
+	err := cfg.Validate()
+	if err == nil || !strings.Contains(err.Error(), "JWT_SECRET or JWT_KEYS is required") {
+		t.Fatalf("Validate without a signing key = %v", err)
+	}
+
+	cfg.JWT.Secret = strings.Repeat("s", 32)
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate with a signing key = %v", err)
+	}
+}
@@ -3,33 +3,83 @@ package config
 import (
 	"fmt"
 	"log"
-	"os"
+	"time"
 
-	"github.com/joho/godotenv"
+	"github.com/glebarez/sqlite"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
 
-// Init db and automigrate
-func InitDB() *gorm.DB {
-	err := godotenv.Load()
-	if err != nil {
-		log.Fatal("Error loading .env file")
+// maxConnectBackoff caps the wait between connection attempts.
+const maxConnectBackoff = 30 * time.Second
+
+// InitDB connects to the database and sets up its connection pool. A
+// database that is not reachable yet, such as one starting alongside the
+// service, is retried with exponential backoff.
+func InitDB(cfg DatabaseConfig) (*gorm.DB, error) {
+	attempts := max(cfg.ConnectAttempts, 1)
+	wait := cfg.ConnectBackoff
+	for attempt := 1; ; attempt++ {
+		db, err := open(cfg)
+		if err == nil {
+			return db, configurePool(db, cfg)
+		}
+		if attempt == attempts {
+			return nil, fmt.Errorf("connecting to the database failed after %d attempts: %w", attempts, err)
+		}
+
+		log.Printf("Connecting to the database failed (attempt %d of %d), retrying in %s: %v", attempt, attempts, wait, err)
+		time.Sleep(wait)
+		wait = min(wait*2, maxConnectBackoff)
 	}
+}
 
-	dbUser := os.Getenv("DB_USER")
-	dbPassword := os.Getenv("DB_PASSWORD")
-	dbHost := os.Getenv("DB_HOST")
-	dbPort := os.Getenv("DB_PORT")
-	dbName := os.Getenv("DB_NAME")
+// open connects with the configured driver. gorm pings the database, so an
+// unreachable server fails here.
+func open(cfg DatabaseConfig) (*gorm.DB, error) {
+	switch cfg.Driver {
+	case "postgres":
+		dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=%s TimeZone=%s",
+			cfg.Host, cfg.User, cfg.Password, cfg.Name, cfg.Port, cfg.SSLMode, cfg.TimeZone)
+		return gorm.Open(postgres.Open(dsn), &gorm.Config{
+			PrepareStmt: false,
+		})
+	case "sqlite":
+		return gorm.Open(sqlite.Open(sqliteDSN(cfg.Path)), &gorm.Config{})
+	default:
+		return nil, fmt.Errorf("unknown database driver %q", cfg.Driver)
+	}
+}
 
-	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=disable TimeZone=Asia/Jakarta", dbHost, dbUser, dbPassword, dbName, dbPort)
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{
-		PrepareStmt: false,
-	})
+// sqliteDSN opens the database file at path, or an in-memory database for
+// ":memory:". Foreign keys are enforced as on Postgres, and writers wait for
+// each other instead of failing with "database is locked".
+func sqliteDSN(path string) string {
+	dsn := "file:" + path + "?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)"
+	if path != ":memory:" {
+		dsn += "&_pragma=journal_mode(WAL)"
+	}
+	return dsn
+}
+
+func configurePool(db *gorm.DB, cfg DatabaseConfig) error {
+	sqlDB, err := db.DB()
 	if err != nil {
-		log.Fatal("Failed to connect to database:", err)
+		return err
 	}
 
-	return db
+	sqlDB.SetMaxOpenConns(cfg.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(cfg.MaxIdleConns)
+	sqlDB.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	sqlDB.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+
+	// Every connection to ":memory:" gets its own empty database, so there
+	// must only ever be one, and it must never be closed
+	if cfg.Driver == "sqlite" && cfg.Path == ":memory:" {
+		sqlDB.SetMaxOpenConns(1)
+		sqlDB.SetMaxIdleConns(1)
+		sqlDB.SetConnMaxLifetime(0)
+		sqlDB.SetConnMaxIdleTime(0)
+	}
+	return nil
 }
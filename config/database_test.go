@@ -0,0 +1,41 @@
+package config
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInitDBRetriesThenGivesUp(t *testing.T) {
+	cfg := DatabaseConfig{
+		Driver:          "sqlite",
+		Path:            filepath.Join(t.TempDir(), "missing", "library.db"),
+		ConnectAttempts: 3,
+		ConnectBackoff:  time.Millisecond,
+	}
+
+	_, err := InitDB(cfg)
+	if err == nil || !strings.Contains(err.Error(), "failed after 3 attempts") {
+		t.Fatalf("InitDB err = %v, want failure after 3 attempts", err)
+	}
+}
+
+func TestInitDBConfiguresPool(t *testing.T) {
+	cfg := Default().Database
+	cfg.Driver = "sqlite"
+	cfg.Path = filepath.Join(t.TempDir(), "library.db")
+
+	db, err := InitDB(cfg)
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sqlDB.Close()
+	if got := sqlDB.Stats().MaxOpenConnections; got != cfg.MaxOpenConns {
+		t.Fatalf("MaxOpenConnections = %d, want %d", got, cfg.MaxOpenConns)
+	}
+}
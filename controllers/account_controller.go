@@ -0,0 +1,189 @@
+package controllers
+
+import (
+	"errors"
+	"finalp2/auth"
+	"finalp2/mailer"
+	"finalp2/models"
+	"finalp2/utils"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+type TokenInput struct {
+	Token string `json:"token" validate:"required"`
+}
+
+type ForgotPasswordInput struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+func (i *ForgotPasswordInput) Normalize() {
+	i.Email = utils.NormalizeEmail(i.Email)
+}
+
+type ResetPasswordInput struct {
+	Token       string `json:"token" validate:"required"`
+	NewPassword string `json:"new_password" validate:"required,password"`
+}
+
+// @Summary Request email verification
+// @Description Sends a new email verification link to the authenticated user
+// @Tags users
+// @Produce  json
+// @Success 200 {object} map[string]string "Verification email sent"
+// @Failure 400 {object} utils.APIError "Email already verified"
+// @Failure 500 {object} utils.APIError "Failed to send verification email"
+// @Security ApiKeyAuth
+// @Router /users/verify-email/request [post]
+func (h *UserHandler) RequestEmailVerification(c echo.Context) error {
+	user := auth.CurrentUser(c)
+	if user.EmailVerifiedAt != nil {
+		return utils.HandleError(c, utils.NewBadRequestError("Email is already verified"))
+	}
+
+	if err := h.sendVerificationEmail(c, *user); err != nil {
+		return utils.HandleError(c, utils.NewInternalError("Failed to send verification email"))
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{
+		"message": "Verification email sent",
+	})
+}
+
+// @Summary Verify email
+// @Description Confirms the user's email address with the token from the verification email
+// @Tags users
+// @Accept  json
+// @Produce  json
+// @Param   tokenInput  body  TokenInput  true  "Verification token"
+// @Success 200 {object} map[string]string "Email verified"
+// @Failure 400 {object} utils.APIError "Invalid or expired token"
+// @Failure 500 {object} utils.APIError "Failed to verify email"
+// @Router /users/verify-email/confirm [post]
+func (h *UserHandler) VerifyEmail(c echo.Context) error {
+	input := new(TokenInput)
+	if apiErr := utils.BindAndValidate(c, input); apiErr != nil {
+		return utils.HandleError(c, apiErr)
+	}
+
+	userID, err := h.storeFor(c).ActionTokens().Consume(h.keys, input.Token, auth.PurposeVerifyEmail)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidActionToken) {
+			return utils.HandleError(c, utils.NewBadRequestError("Invalid or expired token"))
+		}
+		return utils.HandleError(c, utils.NewInternalError("Failed to verify email"))
+	}
+
+	if err := h.storeFor(c).Users().Update(userID, map[string]interface{}{"email_verified_at": time.Now()}); err != nil {
+		return utils.HandleError(c, utils.NewInternalError("Failed to verify email"))
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{
+		"message": "Email verified",
+	})
+}
+
+// @Summary Forgot password
+// @Description Sends a password reset link when an account with the email exists. The response is the same either way.
+// @Tags users
+// @Accept  json
+// @Produce  json
+// @Param   forgotPasswordInput  body  ForgotPasswordInput  true  "Account email"
+// @Success 200 {object} map[string]string "Reset email sent if the account exists"
+// @Failure 400 {object} utils.APIError "Invalid input"
+// @Router /users/password/forgot [post]
+func (h *UserHandler) ForgotPassword(c echo.Context) error {
+	input := new(ForgotPasswordInput)
+	if apiErr := utils.BindAndValidate(c, input); apiErr != nil {
+		return utils.HandleError(c, apiErr)
+	}
+
+	response := echo.Map{
+		"message": "If an account with that email exists, a password reset link has been sent",
+	}
+
+	user, err := h.storeFor(c).Users().FindActiveByEmail(input.Email)
+	if err != nil {
+		return c.JSON(http.StatusOK, response)
+	}
+
+	token, err := h.storeFor(c).ActionTokens().Issue(h.keys, *user, auth.PurposeResetPassword, auth.ResetPasswordTokenTTL)
+	if err != nil {
+		c.Logger().Errorf("issuing password reset token for user %d: %v", user.ID, err)
+		return c.JSON(http.StatusOK, response)
+	}
+
+	link := fmt.Sprintf("%s/reset-password?token=%s", h.cfg.Server.AppURL, url.QueryEscape(token))
+	err = h.mail.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\nSomeone asked to reset the password of your Book Rental account. "+
+			"Use the link below within %s to choose a new password:\n\n%s\n\n"+
+			"If you did not ask for this, you can ignore this email.\n",
+			user.FirstName, auth.ResetPasswordTokenTTL, link),
+	})
+	if err != nil {
+		c.Logger().Errorf("sending password reset email to user %d: %v", user.ID, err)
+	}
+
+	return c.JSON(http.StatusOK, response)
+}
+
+// @Summary Reset password
+// @Description Sets a new password with the token from the reset email. All existing sessions are logged out.
+// @Tags users
+// @Accept  json
+// @Produce  json
+// @Param   resetPasswordInput  body  ResetPasswordInput  true  "Reset token and new password"
+// @Success 200 {object} map[string]string "Password changed"
+// @Failure 400 {object} utils.APIError "Invalid input or invalid or expired token"
+// @Failure 500 {object} utils.APIError "Failed to reset password"
+// @Router /users/password/reset [post]
+func (h *UserHandler) ResetPassword(c echo.Context) error {
+	input := new(ResetPasswordInput)
+	if apiErr := utils.BindAndValidate(c, input); apiErr != nil {
+		return utils.HandleError(c, apiErr)
+	}
+
+	userID, err := h.storeFor(c).ActionTokens().Consume(h.keys, input.Token, auth.PurposeResetPassword)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidActionToken) {
+			return utils.HandleError(c, utils.NewBadRequestError("Invalid or expired token"))
+		}
+		return utils.HandleError(c, utils.NewInternalError("Failed to reset password"))
+	}
+
+	hashedPassword, err := h.hasher.Hash(input.NewPassword)
+	if err != nil {
+		return utils.HandleError(c, utils.NewInternalError("Failed to reset password"))
+	}
+
+	if err := h.users.WithContext(c.Request().Context()).SetPassword(userID, hashedPassword, ""); err != nil {
+		return utils.HandleError(c, utils.NewInternalError("Failed to reset password"))
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{
+		"message": "Password changed, please log in again",
+	})
+}
+
+func (h *UserHandler) sendVerificationEmail(c echo.Context, user models.User) error {
+	token, err := h.storeFor(c).ActionTokens().Issue(h.keys, user, auth.PurposeVerifyEmail, auth.VerifyEmailTokenTTL)
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/verify-email?token=%s", h.cfg.Server.AppURL, url.QueryEscape(token))
+	return h.mail.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Hi %s,\n\nPlease confirm your email address for your Book Rental account "+
+			"by opening the link below within %s:\n\n%s\n",
+			user.FirstName, auth.VerifyEmailTokenTTL, link),
+	})
+}
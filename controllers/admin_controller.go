@@ -0,0 +1,65 @@
+package controllers
+
+import (
+	"errors"
+	"finalp2/repository"
+	"finalp2/utils"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+type UnlockInput struct {
+	// IP optionally clears the lockout of a client address as well
+	IP string `json:"ip" validate:"omitempty,ip"`
+}
+
+// @Summary Unlock a user account
+// @Description Clears the failed login attempts and temporary lockout of a user's account, and optionally of a client IP address
+// @Tags Admin
+// @Accept  json
+// @Produce  json
+// @Param   id  path  int  true  "User ID"
+// @Param   unlockInput  body  UnlockInput  false  "IP address to unlock"
+// @Success 200 {object} map[string]string "Account unlocked"
+// @Failure 400 {object} utils.APIError "Invalid input"
+// @Failure 403 {object} utils.APIError "Admin access required"
+// @Failure 404 {object} utils.APIError "User not found"
+// @Failure 500 {object} utils.APIError "Failed to unlock account"
+// @Security ApiKeyAuth
+// @Router /admin/users/{id}/unlock [post]
+func (h *UserHandler) UnlockUser(c echo.Context) error {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return utils.HandleError(c, utils.NewBadRequestError("Invalid user ID"))
+	}
+
+	input := new(UnlockInput)
+	if c.Request().ContentLength != 0 {
+		if apiErr := utils.BindAndValidate(c, input); apiErr != nil {
+			return utils.HandleError(c, apiErr)
+		}
+	}
+
+	user, err := h.storeFor(c).Users().FindByID(uint(userID))
+	if errors.Is(err, repository.ErrNotFound) {
+		return utils.HandleError(c, utils.NewNotFoundError("User not found"))
+	}
+	if err != nil {
+		return utils.HandleError(c, utils.NewInternalError("Failed to unlock account"))
+	}
+
+	if err := h.limiter.Unlock(user.Email); err != nil {
+		return utils.HandleError(c, utils.NewInternalError("Failed to unlock account"))
+	}
+	if input.IP != "" {
+		if err := h.limiter.UnlockIP(input.IP); err != nil {
+			return utils.HandleError(c, utils.NewInternalError("Failed to unlock IP address"))
+		}
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{
+		"message": "Account unlocked",
+	})
+}
@@ -0,0 +1,198 @@
+package controllers
+
+import (
+	"finalp2/auth"
+	"finalp2/models"
+	"finalp2/utils"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+type APIKeyInput struct {
+	Name   string   `json:"name" validate:"required,notblank,max=100" example:"inventory sync"`
+	Scopes []string `json:"scopes" validate:"required,min=1,unique,dive,oneof=catalog:read inventory:manage reports:read metrics:read" example:"catalog:read"`
+	// ExpiresInDays is optional; without it the key works until revoked
+	ExpiresInDays int `json:"expires_in_days" validate:"omitempty,min=1,max=365"`
+}
+
+type APIKeyOutput struct {
+	ID         uint       `json:"api_key_id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// CreatedAPIKey is the only response that contains the key itself.
+type CreatedAPIKey struct {
+	APIKeyOutput
+	Key string `json:"key"`
+}
+
+// @Summary Create an API key
+// @Description Creates a named API key for scripts and integrations. Send it in the X-API-Key header. The key is only shown in this response.
+// @Tags users
+// @Accept  json
+// @Produce  json
+// @Param   apiKeyInput  body  APIKeyInput  true  "Name, scopes and expiry"
+// @Success 201 {object} CreatedAPIKey "The new key"
+// @Failure 400 {object} utils.APIError "Invalid input or too many keys"
+// @Failure 401 {object} utils.APIError "Invalid token"
+// @Failure 403 {object} utils.APIError "Scope requires staff access"
+// @Failure 500 {object} utils.APIError "Failed to create API key"
+// @Security ApiKeyAuth
+// @Router /users/me/api-keys [post]
+func (h *UserHandler) CreateAPIKey(c echo.Context) error {
+	user := auth.CurrentUser(c)
+
+	input := new(APIKeyInput)
+	if apiErr := utils.BindAndValidate(c, input); apiErr != nil {
+		return utils.HandleError(c, apiErr)
+	}
+
+	if !user.IsStaff() {
+		for _, scope := range input.Scopes {
+			for _, staffScope := range auth.StaffScopes {
+				if scope == staffScope {
+					return utils.HandleError(c, utils.NewForbiddenError("The "+scope+" scope requires staff access"))
+				}
+			}
+		}
+	}
+
+	var expiresAt *time.Time
+	if input.ExpiresInDays > 0 {
+		expiry := time.Now().AddDate(0, 0, input.ExpiresInDays)
+		expiresAt = &expiry
+	}
+
+	key, raw, err := h.users.WithContext(c.Request().Context()).CreateAPIKey(user.ID, strings.TrimSpace(input.Name), input.Scopes, expiresAt)
+	if err != nil {
+		return utils.HandleError(c, utils.ToAPIError(err, "Failed to create API key"))
+	}
+
+	return c.JSON(http.StatusCreated, CreatedAPIKey{
+		APIKeyOutput: newAPIKeyOutput(*key),
+		Key:          raw,
+	})
+}
+
+// @Summary List my API keys
+// @Description Lists the authenticated user's API keys, including revoked and expired ones
+// @Tags users
+// @Produce  json
+// @Success 200 {array} APIKeyOutput "API keys"
+// @Failure 401 {object} utils.APIError "Invalid token"
+// @Failure 500 {object} utils.APIError "Failed to load API keys"
+// @Security ApiKeyAuth
+// @Router /users/me/api-keys [get]
+func (h *UserHandler) ListAPIKeys(c echo.Context) error {
+	return h.listAPIKeys(c, auth.CurrentUser(c).ID)
+}
+
+// @Summary Revoke an API key
+// @Description Revokes one of the authenticated user's API keys
+// @Tags users
+// @Produce  json
+// @Param   id  path  int  true  "API key ID"
+// @Success 200 {object} map[string]string "API key revoked"
+// @Failure 400 {object} utils.APIError "Invalid API key ID"
+// @Failure 404 {object} utils.APIError "API key not found"
+// @Failure 500 {object} utils.APIError "Failed to revoke API key"
+// @Security ApiKeyAuth
+// @Router /users/me/api-keys/{id} [delete]
+func (h *UserHandler) RevokeAPIKey(c echo.Context) error {
+	return h.revokeAPIKey(c, auth.CurrentUser(c).ID, c.Param("id"))
+}
+
+// @Summary List a user's API keys
+// @Description Lists the API keys of any user
+// @Tags Admin
+// @Produce  json
+// @Param   id  path  int  true  "User ID"
+// @Success 200 {array} APIKeyOutput "API keys"
+// @Failure 400 {object} utils.APIError "Invalid user ID"
+// @Failure 403 {object} utils.APIError "Admin access required"
+// @Failure 500 {object} utils.APIError "Failed to load API keys"
+// @Security ApiKeyAuth
+// @Router /admin/users/{id}/api-keys [get]
+func (h *UserHandler) ListUserAPIKeys(c echo.Context) error {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return utils.HandleError(c, utils.NewBadRequestError("Invalid user ID"))
+	}
+	return h.listAPIKeys(c, uint(userID))
+}
+
+// @Summary Revoke a user's API key
+// @Description Revokes an API key of any user, e.g. when it has leaked
+// @Tags Admin
+// @Produce  json
+// @Param   id      path  int  true  "User ID"
+// @Param   key_id  path  int  true  "API key ID"
+// @Success 200 {object} map[string]string "API key revoked"
+// @Failure 400 {object} utils.APIError "Invalid ID"
+// @Failure 403 {object} utils.APIError "Admin access required"
+// @Failure 404 {object} utils.APIError "API key not found"
+// @Failure 500 {object} utils.APIError "Failed to revoke API key"
+// @Security ApiKeyAuth
+// @Router /admin/users/{id}/api-keys/{key_id} [delete]
+func (h *UserHandler) RevokeUserAPIKey(c echo.Context) error {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return utils.HandleError(c, utils.NewBadRequestError("Invalid user ID"))
+	}
+	return h.revokeAPIKey(c, uint(userID), c.Param("key_id"))
+}
+
+func (h *UserHandler) listAPIKeys(c echo.Context, userID uint) error {
+	keys, err := h.storeFor(c).APIKeys().List(userID)
+	if err != nil {
+		return utils.HandleError(c, utils.NewInternalError("Failed to load API keys"))
+	}
+
+	output := make([]APIKeyOutput, len(keys))
+	for i, key := range keys {
+		output[i] = newAPIKeyOutput(key)
+	}
+	return c.JSON(http.StatusOK, output)
+}
+
+func (h *UserHandler) revokeAPIKey(c echo.Context, userID uint, rawKeyID string) error {
+	keyID, err := strconv.Atoi(rawKeyID)
+	if err != nil {
+		return utils.HandleError(c, utils.NewBadRequestError("Invalid API key ID"))
+	}
+
+	revoked, err := h.storeFor(c).APIKeys().Revoke(userID, uint(keyID))
+	if err != nil {
+		return utils.HandleError(c, utils.NewInternalError("Failed to revoke API key"))
+	}
+	if !revoked {
+		return utils.HandleError(c, utils.NewNotFoundError("API key not found"))
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{
+		"message": "API key revoked",
+	})
+}
+
+func newAPIKeyOutput(key models.APIKey) APIKeyOutput {
+	return APIKeyOutput{
+		ID:         key.ID,
+		Name:       key.Name,
+		Prefix:     key.Prefix,
+		Scopes:     key.ScopeList(),
+		ExpiresAt:  key.ExpiresAt,
+		LastUsedAt: key.LastUsedAt,
+		RevokedAt:  key.RevokedAt,
+		CreatedAt:  key.CreatedAt,
+	}
+}
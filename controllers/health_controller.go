@@ -0,0 +1,187 @@
+package controllers
+
+import (
+	"context"
+	"finalp2/config"
+	"finalp2/migrations"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// readinessCheckTimeout bounds the readiness checks, which run concurrently,
+// so an orchestrator probing the service gets an answer well within its own
+// timeout.
+const readinessCheckTimeout = 2 * time.Second
+
+// paymentGatewayCheckInterval is how long the outcome of probing the payment
+// gateway is reused, so frequent readiness probes don't all reach it.
+const paymentGatewayCheckInterval = 30 * time.Second
+
+type HealthHandler struct {
+	db       *gorm.DB
+	xendit   config.XenditConfig
+	client   *http.Client
+	draining atomic.Bool
+
+	gatewayMu        sync.Mutex
+	gatewayCheckedAt time.Time
+	gatewayErr       error
+}
+
+func NewHealthHandler(db *gorm.DB, xendit config.XenditConfig) *HealthHandler {
+	return &HealthHandler{db: db, xendit: xendit, client: &http.Client{Timeout: readinessCheckTimeout}}
+}
+
+// Drain makes the service report that it is not ready, so no new traffic is
+// sent to it while it shuts down.
+func (h *HealthHandler) Drain() {
+	h.draining.Store(true)
+}
+
+// HealthStatus is the outcome of the health checks.
+type HealthStatus struct {
+	// Status is "ok", "unavailable" or "shutting_down"
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+// CheckResult is the outcome of a single readiness check.
+type CheckResult struct {
+	Status     string `json:"status"`
+	DurationMs int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+}
+
+// @Summary Liveness check
+// @Description Reports that the process is running and serving requests. It does not look at the database or other dependencies.
+// @Tags Monitoring
+// @Produce  json
+// @Success 200 {object} HealthStatus "The service is alive"
+// @Router /healthz [get]
+func (h *HealthHandler) Liveness(c echo.Context) error {
+	return c.JSON(http.StatusOK, HealthStatus{Status: "ok"})
+}
+
+// @Summary Readiness check
+// @Description Reports whether the service can take traffic: the database answers, its schema is at the latest migration, and the payment gateway is reachable when its API URL is configured. The gateway is probed at most every 30 seconds. Fails while the service shuts down.
+// @Tags Monitoring
+// @Produce  json
+// @Success 200 {object} HealthStatus "The service is ready"
+// @Failure 503 {object} HealthStatus "A check failed or the service is shutting down"
+// @Router /readyz [get]
+func (h *HealthHandler) Readiness(c echo.Context) error {
+	if h.draining.Load() {
+		return c.JSON(http.StatusServiceUnavailable, HealthStatus{Status: "shutting_down"})
+	}
+
+	checks := map[string]func(ctx context.Context) error{
+		"database":   h.checkDatabase,
+		"migrations": h.checkMigrations,
+	}
+	if h.xendit.APIURL != "" {
+		checks["payment_gateway"] = h.checkPaymentGateway
+	}
+
+	status := HealthStatus{Status: "ok", Checks: make(map[string]CheckResult, len(checks))}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range checks {
+		wg.Add(1)
+		go func(name string, check func(ctx context.Context) error) {
+			defer wg.Done()
+			result := runCheck(c.Request().Context(), check)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if result.Status != "ok" {
+				status.Status = "unavailable"
+			}
+			status.Checks[name] = result
+		}(name, check)
+	}
+	wg.Wait()
+
+	code := http.StatusOK
+	if status.Status != "ok" {
+		code = http.StatusServiceUnavailable
+	}
+	return c.JSON(code, status)
+}
+
+func runCheck(ctx context.Context, check func(ctx context.Context) error) CheckResult {
+	ctx, cancel := context.WithTimeout(ctx, readinessCheckTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := check(ctx)
+	result := CheckResult{Status: "ok", DurationMs: time.Since(start).Milliseconds()}
+	if err != nil {
+		result.Status = "failed"
+		result.Error = err.Error()
+	}
+	return result
+}
+
+func (h *HealthHandler) checkDatabase(ctx context.Context) error {
+	sqlDB, err := h.db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.PingContext(ctx)
+}
+
+// checkMigrations fails while migrations are pending, as the code expects
+// the latest schema. It only reads schema_migrations.
+func (h *HealthHandler) checkMigrations(ctx context.Context) error {
+	migrator, err := migrations.New(h.db.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	pending, err := migrator.Pending()
+	if err != nil {
+		return err
+	}
+	if pending > 0 {
+		return fmt.Errorf("%d migrations pending", pending)
+	}
+	return nil
+}
+
+// checkPaymentGateway reports the last outcome of probing the gateway while
+// it is fresh, and probes it again otherwise. Concurrent checks wait for the
+// same probe.
+func (h *HealthHandler) checkPaymentGateway(ctx context.Context) error {
+	h.gatewayMu.Lock()
+	defer h.gatewayMu.Unlock()
+	if !h.gatewayCheckedAt.IsZero() && time.Since(h.gatewayCheckedAt) < paymentGatewayCheckInterval {
+		return h.gatewayErr
+	}
+
+	h.gatewayErr = h.probePaymentGateway(ctx)
+	h.gatewayCheckedAt = time.Now()
+	return h.gatewayErr
+}
+
+// probePaymentGateway only needs an answer from the gateway; any response
+// short of a server error means it is up.
+func (h *HealthHandler) probePaymentGateway(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, h.xendit.APIURL, nil)
+	if err != nil {
+		return err
+	}
+	res, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("payment gateway answered %s", res.Status)
+	}
+	return nil
+}
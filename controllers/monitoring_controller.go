@@ -0,0 +1,66 @@
+package controllers
+
+import (
+	"database/sql"
+	"finalp2/utils"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+type MonitoringHandler struct {
+	db *gorm.DB
+}
+
+func NewMonitoringHandler(db *gorm.DB) *MonitoringHandler {
+	return &MonitoringHandler{db: db}
+}
+
+// PoolStats describes the database connection pool.
+type PoolStats struct {
+	MaxOpenConnections int `json:"max_open_connections"`
+	OpenConnections    int `json:"open_connections"`
+	InUse              int `json:"in_use"`
+	Idle               int `json:"idle"`
+	// WaitCount and WaitDurationMs add up the times a query had to wait for
+	// a free connection
+	WaitCount         int64 `json:"wait_count"`
+	WaitDurationMs    int64 `json:"wait_duration_ms"`
+	MaxIdleClosed     int64 `json:"max_idle_closed"`
+	MaxIdleTimeClosed int64 `json:"max_idle_time_closed"`
+	MaxLifetimeClosed int64 `json:"max_lifetime_closed"`
+}
+
+func newPoolStats(stats sql.DBStats) PoolStats {
+	return PoolStats{
+		MaxOpenConnections: stats.MaxOpenConnections,
+		OpenConnections:    stats.OpenConnections,
+		InUse:              stats.InUse,
+		Idle:               stats.Idle,
+		WaitCount:          stats.WaitCount,
+		WaitDurationMs:     stats.WaitDuration.Milliseconds(),
+		MaxIdleClosed:      stats.MaxIdleClosed,
+		MaxIdleTimeClosed:  stats.MaxIdleTimeClosed,
+		MaxLifetimeClosed:  stats.MaxLifetimeClosed,
+	}
+}
+
+// @Summary Database pool statistics
+// @Description Reports the database connection pool: its size, how many connections are in use, and how often queries waited for one. Counters only grow while the service runs.
+// @Tags Monitoring
+// @Produce  json
+// @Success 200 {object} PoolStats "Connection pool statistics"
+// @Failure 401 {object} utils.APIError "Invalid token or API key"
+// @Failure 403 {object} utils.APIError "Staff access or the metrics:read scope required"
+// @Failure 500 {object} utils.APIError "Failed to read pool statistics"
+// @Security ApiKeyAuth
+// @Security APIKey
+// @Router /metrics/database [get]
+func (h *MonitoringHandler) DatabaseStats(c echo.Context) error {
+	sqlDB, err := h.db.DB()
+	if err != nil {
+		return utils.HandleError(c, utils.NewInternalError("Failed to read pool statistics"))
+	}
+	return c.JSON(http.StatusOK, newPoolStats(sqlDB.Stats()))
+}
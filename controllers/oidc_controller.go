@@ -0,0 +1,127 @@
+package controllers
+
+import (
+	"finalp2/auth"
+	"finalp2/oidc"
+	"finalp2/utils"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+const oidcStateCookie = "oidc_state"
+
+type OIDCProviders struct {
+	Providers []string `json:"providers"`
+}
+
+// @Summary List social login providers
+// @Description Lists the OpenID Connect providers users can sign in with
+// @Tags users
+// @Produce  json
+// @Success 200 {object} OIDCProviders "Configured providers"
+// @Router /users/oidc/providers [get]
+func (h *UserHandler) ListOIDCProviders(c echo.Context) error {
+	return c.JSON(http.StatusOK, OIDCProviders{Providers: h.providers.Names()})
+}
+
+// @Summary Start a social login
+// @Description Redirects the browser to the identity provider. The login state is kept in a short-lived cookie until the provider redirects back to the callback.
+// @Tags users
+// @Param   provider  path  string  true  "Provider name"
+// @Success 302 "Redirect to the identity provider"
+// @Failure 404 {object} utils.APIError "Unknown provider"
+// @Failure 500 {object} utils.APIError "Identity provider unavailable"
+// @Router /users/oidc/{provider}/login [get]
+func (h *UserHandler) OIDCLogin(c echo.Context) error {
+	provider, ok := h.providers.Get(c.Param("provider"))
+	if !ok {
+		return utils.HandleError(c, utils.NewNotFoundError("Unknown login provider"))
+	}
+
+	verifier := oidc.GenerateVerifier()
+	state, signedState, err := auth.NewOIDCState(h.keys, provider.Name(), verifier)
+	if err != nil {
+		return utils.HandleError(c, utils.NewInternalError("Failed to start login"))
+	}
+
+	url, err := provider.AuthCodeURL(c.Request().Context(), state.Id, state.Nonce, verifier)
+	if err != nil {
+		c.Logger().Errorf("starting %s login: %v", provider.Name(), err)
+		return utils.HandleError(c, utils.NewInternalError("The login provider is unavailable, please try again later"))
+	}
+
+	c.SetCookie(oidcCookie(c, signedState, int(auth.OIDCStateTTL.Seconds())))
+	return c.Redirect(http.StatusFound, url)
+}
+
+// @Summary Finish a social login
+// @Description Callback the identity provider redirects to. Signs in the user linked to the provider account, links an existing user with the same verified email, or creates a new user.
+// @Tags users
+// @Produce  json
+// @Param   provider  path   string  true  "Provider name"
+// @Param   code      query  string  true  "Authorization code"
+// @Param   state     query  string  true  "Login state"
+// @Success 200 {object} auth.TokenPair "Access and refresh tokens, or a TwoFactorChallenge when two-factor authentication is enabled"
+// @Failure 400 {object} utils.APIError "Invalid or expired login state"
+// @Failure 401 {object} utils.APIError "Login could not be verified"
+// @Failure 403 {object} utils.APIError "Email not verified by the provider or account deleted"
+// @Failure 404 {object} utils.APIError "Unknown provider"
+// @Failure 500 {object} utils.APIError "Failed to log in"
+// @Router /users/oidc/{provider}/callback [get]
+func (h *UserHandler) OIDCCallback(c echo.Context) error {
+	provider, ok := h.providers.Get(c.Param("provider"))
+	if !ok {
+		return utils.HandleError(c, utils.NewNotFoundError("Unknown login provider"))
+	}
+
+	if reason := c.QueryParam("error"); reason != "" {
+		return utils.HandleError(c, utils.NewBadRequestError("Login was cancelled or refused by the provider: "+reason))
+	}
+
+	cookie, err := c.Cookie(oidcStateCookie)
+	if err != nil {
+		return utils.HandleError(c, utils.NewBadRequestError("Login session expired, please try again"))
+	}
+	state, err := auth.ParseOIDCState(h.keys, cookie.Value, provider.Name(), c.QueryParam("state"))
+	if err != nil {
+		return utils.HandleError(c, utils.NewBadRequestError("Login session expired, please try again"))
+	}
+	// The state is single-use
+	c.SetCookie(oidcCookie(c, "", -1))
+
+	identity, err := provider.Exchange(c.Request().Context(), c.QueryParam("code"), state.Verifier, state.Nonce)
+	if err != nil {
+		c.Logger().Errorf("finishing %s login: %v", provider.Name(), err)
+		return utils.HandleError(c, utils.NewUnauthorizedError("Could not verify the login with the provider"))
+	}
+
+	user, err := h.users.WithContext(c.Request().Context()).FindOrLinkIdentity(identity)
+	if err != nil {
+		return utils.HandleError(c, utils.ToAPIError(err, "Failed to log in"))
+	}
+
+	if user.TOTPEnabledAt != nil {
+		return h.respondTwoFactorChallenge(c, *user, auth.AuthMethodFederated)
+	}
+
+	tokens, err := h.storeFor(c).Sessions().Issue(h.keys, *user, auth.AuthMethodFederated, false)
+	if err != nil {
+		return utils.HandleError(c, utils.NewInternalError("Failed to generate token"))
+	}
+
+	return c.JSON(http.StatusOK, tokens)
+}
+
+func oidcCookie(c echo.Context, value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    value,
+		Path:     "/users/oidc/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   c.Scheme() == "https",
+		// Lax so the cookie comes along on the provider's top-level redirect
+		SameSite: http.SameSiteLaxMode,
+	}
+}
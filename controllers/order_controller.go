@@ -0,0 +1,207 @@
+package controllers
+
+import (
+	"finalp2/auth"
+	"finalp2/models"
+	"finalp2/repository"
+	"finalp2/services"
+	"finalp2/utils"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+type RentalHandler struct {
+	rentals *services.RentalService
+}
+
+func NewRentalHandler(rentals *services.RentalService) *RentalHandler {
+	return &RentalHandler{rentals: rentals}
+}
+
+type OutOrder struct {
+	OrderID    uint                `json:"rental_id"`
+	TotalPrice uint                `json:"total_price"`
+	Date       *time.Time          `json:"date"`
+	Status     models.RentalStatus `json:"status"`
+	Books      []models.Book       `json:"books"`
+}
+
+type OrderItem struct {
+	RentalDetailID uint         `json:"rental_detail_id"`
+	Book           BookResponse `json:"book"`
+	DueDate        *time.Time   `json:"due_date"`
+	Returned       bool         `json:"returned"`
+}
+
+type OrderDetail struct {
+	OrderID    uint                `json:"rental_id"`
+	UserID     uint                `json:"user_id"`
+	TotalPrice uint                `json:"total_price"`
+	Date       *time.Time          `json:"date"`
+	Status     models.RentalStatus `json:"status"`
+	Items      []OrderItem         `json:"items"`
+	Payments   []models.Payment    `json:"payments"`
+	InvoiceURL string              `json:"invoice_url,omitempty"`
+}
+
+// GetRent returns the rentals made by the user, newest first
+// @Summary Get user rentals
+// @Description Get the rentals made by the user, optionally filtered by status and rental date. Results are paginated; the total number of matching rentals is returned in the X-Total-Count header.
+// @Tags Rentals
+// @Produce json
+// @Param status query string false "Comma separated rental statuses, e.g. active,overdue"
+// @Param from query string false "Earliest rental date (YYYY-MM-DD)"
+// @Param to query string false "Latest rental date (YYYY-MM-DD)"
+// @Param page query int false "Page number, starting at 1"
+// @Param limit query int false "Rentals per page (max 100)"
+// @Success 200 {array} OutOrder "List of user rentals"
+// @Failure 400 {object} utils.APIError "Invalid filter"
+// @Failure 500 {object} utils.APIError "Error fetching rentals"
+// @Security ApiKeyAuth
+// @Security APIKey
+// @Router /users/rent-history [get]
+func (h *RentalHandler) GetRent(c echo.Context) error {
+	var filter repository.RentalFilter
+
+	if param := c.QueryParam("status"); param != "" {
+		for _, s := range strings.Split(param, ",") {
+			status := models.RentalStatus(strings.TrimSpace(s))
+			if !status.Valid() {
+				return utils.HandleError(c, utils.NewBadRequestError(fmt.Sprintf("Unknown rental status %q", status)))
+			}
+			filter.Statuses = append(filter.Statuses, status)
+		}
+	}
+	if param := c.QueryParam("from"); param != "" {
+		from, err := time.Parse("2006-01-02", param)
+		if err != nil {
+			return utils.HandleError(c, utils.NewBadRequestError("Invalid from date, expected YYYY-MM-DD"))
+		}
+		filter.From = &from
+	}
+	if param := c.QueryParam("to"); param != "" {
+		to, err := time.Parse("2006-01-02", param)
+		if err != nil {
+			return utils.HandleError(c, utils.NewBadRequestError("Invalid to date, expected YYYY-MM-DD"))
+		}
+		// Include the whole last day
+		to = to.AddDate(0, 0, 1)
+		filter.To = &to
+	}
+
+	page, limit, err := pagination(c)
+	if err != nil {
+		return utils.HandleError(c, utils.NewBadRequestError(err.Error()))
+	}
+
+	orders, total, err := h.rentals.WithContext(c.Request().Context()).History(auth.CurrentUser(c).ID, filter, page, limit)
+	if err != nil {
+		return utils.HandleError(c, utils.ToAPIError(err, "Error fetching orders"))
+	}
+
+	out := make([]OutOrder, 0, len(orders))
+	for _, order := range orders {
+		books := make([]models.Book, 0, len(order.Details))
+		for _, orderItem := range order.Details {
+			books = append(books, orderItem.Book)
+		}
+		out = append(out, OutOrder{
+			OrderID:    order.ID,
+			TotalPrice: order.TotalPrice,
+			Date:       order.RentalDate,
+			Status:     order.RentalStatus,
+			Books:      books,
+		})
+	}
+
+	c.Response().Header().Set("X-Total-Count", strconv.FormatInt(total, 10))
+	c.Response().Header().Set("X-Page", strconv.Itoa(page))
+	c.Response().Header().Set("X-Per-Page", strconv.Itoa(limit))
+	return c.JSON(http.StatusOK, out)
+}
+
+// AddOrder creates a new order from the user's cart
+// @Summary Create a new order
+// @Description Create a new order from the items in the user's cart. The cart will be cleared after the order is created.
+// @Tags Orders
+// @Produce json
+// @Param Idempotency-Key header string false "Unique key that makes retries of this request safe"
+// @Success 200 {object} map[string]interface{} "Order created successfully"
+// @Failure 400 {object} utils.APIError "Cart is empty, cannot create order"
+// @Failure 409 {object} utils.APIError "A request with the same Idempotency-Key is still being processed"
+// @Failure 422 {object} utils.APIError "Idempotency-Key was already used for a different request"
+// @Failure 500 {object} utils.APIError "Failed to create order or order items"
+// @Security ApiKeyAuth
+// @Router /orders [post]
+func (h *RentalHandler) AddOrder(c echo.Context) error {
+	order, err := h.rentals.WithContext(c.Request().Context()).Checkout(auth.CurrentUser(c).ID)
+	if err != nil {
+		return utils.HandleError(c, utils.ToAPIError(err, "Failed to create order"))
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message":     "Order created successfully",
+		"order_id":    order.ID,
+		"total_price": order.TotalPrice,
+		"status":      order.RentalStatus,
+	})
+}
+
+// GetOrder returns a single rental with its items and payments
+// @Summary Get order detail
+// @Description Get a single rental with each rented book, its due date and return state, and the payments made for it. Only the owner or library staff can view an order.
+// @Tags Orders
+// @Produce json
+// @Param order_id path int true "Order ID"
+// @Success 200 {object} OrderDetail "Order detail"
+// @Failure 400 {object} utils.APIError "Invalid order ID"
+// @Failure 403 {object} utils.APIError "Not allowed to view this order"
+// @Failure 404 {object} utils.APIError "Order not found"
+// @Failure 500 {object} utils.APIError "Error fetching order"
+// @Security ApiKeyAuth
+// @Security APIKey
+// @Router /users/orders/{order_id} [get]
+func (h *RentalHandler) GetOrder(c echo.Context) error {
+	orderID, err := strconv.Atoi(c.Param("order_id"))
+	if err != nil {
+		return utils.HandleError(c, utils.NewBadRequestError("Invalid order ID"))
+	}
+
+	order, err := h.rentals.WithContext(c.Request().Context()).Order(*auth.CurrentUser(c), uint(orderID))
+	if err != nil {
+		return utils.HandleError(c, utils.ToAPIError(err, "Error fetching order"))
+	}
+
+	out := OrderDetail{
+		OrderID:    order.Rental.ID,
+		UserID:     order.Rental.UserID,
+		TotalPrice: order.Rental.TotalPrice,
+		Date:       order.Rental.RentalDate,
+		Status:     order.Rental.RentalStatus,
+		Items:      []OrderItem{},
+		Payments:   order.Payments,
+	}
+	for _, item := range order.Items {
+		out.Items = append(out.Items, OrderItem{
+			RentalDetailID: item.ID,
+			Book:           newBookResponse(item.Book),
+			DueDate:        item.DueDate,
+			Returned:       item.Returned,
+		})
+	}
+
+	// The latest invoice is the one the user should pay or refer to
+	for i := len(order.Payments) - 1; i >= 0; i-- {
+		if order.Payments[i].InvoiceURL != "" {
+			out.InvoiceURL = order.Payments[i].InvoiceURL
+			break
+		}
+	}
+
+	return c.JSON(http.StatusOK, out)
+}
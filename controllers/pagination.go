@@ -0,0 +1,34 @@
+package controllers
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// pagination reads the page and limit query parameters, applying defaults
+// when they are missing.
+func pagination(c echo.Context) (page, limit int, err error) {
+	page, limit = 1, defaultPageSize
+
+	if param := c.QueryParam("page"); param != "" {
+		page, err = strconv.Atoi(param)
+		if err != nil || page < 1 {
+			return 0, 0, errors.New("page must be a positive number")
+		}
+	}
+	if param := c.QueryParam("limit"); param != "" {
+		limit, err = strconv.Atoi(param)
+		if err != nil || limit < 1 || limit > maxPageSize {
+			return 0, 0, errors.New("limit must be between 1 and 100")
+		}
+	}
+
+	return page, limit, nil
+}
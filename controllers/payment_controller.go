@@ -0,0 +1,88 @@
+package controllers
+
+import (
+	"finalp2/auth"
+	"finalp2/services"
+	"finalp2/utils"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+type PaymentHandler struct {
+	payments *services.PaymentService
+}
+
+func NewPaymentHandler(payments *services.PaymentService) *PaymentHandler {
+	return &PaymentHandler{payments: payments}
+}
+
+type TopupRequest struct {
+	Amount uint `json:"amount" validate:"required,gt=0"`
+}
+
+// Topup adds a deposit to the user's account
+// @Summary Add deposit to user account
+// @Description Add a specified amount to the user's deposit
+// @Tags Users
+// @Accept json
+// @Produce json
+// @Param topupRequest body TopupRequest true "Topup Request"
+// @Success 200 {object} map[string]interface{} "Deposit added successfully"
+// @Failure 400 {object} utils.APIError "Invalid request"
+// @Failure 500 {object} utils.APIError "Failed to update user"
+// @Security ApiKeyAuth
+// @Router /topup [post]
+func (h *PaymentHandler) Topup(c echo.Context) error {
+	var topupRequest TopupRequest
+	if apiErr := utils.BindAndValidate(c, &topupRequest); apiErr != nil {
+		return utils.HandleError(c, apiErr)
+	}
+
+	deposit, err := h.payments.WithContext(c.Request().Context()).Topup(auth.CurrentUser(c).ID, topupRequest.Amount)
+	if err != nil {
+		return utils.HandleError(c, utils.ToAPIError(err, "Failed to update user"))
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": fmt.Sprintf("Deposit added. Current deposit amount: %d", deposit),
+	})
+}
+
+// Pay godoc
+// @Summary      Pay for an order
+// @Description  Allows a user to pay for a specific order by ID.
+// @Tags         Payments
+// @Accept       json
+// @Produce      json
+// @Param        order_id  path  int  true  "Order ID"
+// @Param        Idempotency-Key  header  string  false  "Unique key that makes retries of this request safe"
+// @Security     ApiKeyAuth
+// @Success      200  {object}  map[string]interface{}  "Payment successful"
+// @Failure      400  {object}  map[string]interface{}  "Invalid order ID or order already paid"
+// @Failure      401  {object}  map[string]interface{}  "Unauthorized to pay for this order"
+// @Failure      404  {object}  map[string]interface{}  "Order not found"
+// @Failure      409  {object}  utils.APIError  "The order is already being paid, or a request with the same Idempotency-Key is still being processed"
+// @Failure      422  {object}  utils.APIError  "Idempotency-Key was already used for a different request"
+// @Failure      500  {object}  map[string]interface{}  "Internal server error while processing payment"
+// @Router       /pay/{order_id} [post]
+func (h *PaymentHandler) Pay(c echo.Context) error {
+	orderID, err := strconv.Atoi(c.Param("order_id"))
+	if err != nil {
+		return utils.HandleError(c, utils.NewBadRequestError("Invalid order ID"))
+	}
+
+	order, invoice, err := h.payments.WithContext(c.Request().Context()).Pay(*auth.CurrentUser(c), uint(orderID))
+	if err != nil {
+		return utils.HandleError(c, utils.ToAPIError(err, "Internal server error while processing payment"))
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message":  "Payment successful",
+		"invoice":  invoice,
+		"order_id": order.ID,
+		"status":   order.RentalStatus,
+	})
+}
@@ -0,0 +1,249 @@
+package controllers
+
+import (
+	"errors"
+	"finalp2/auth"
+	"finalp2/models"
+	"finalp2/utils"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+type ProfileOutput struct {
+	ID            uint   `json:"user_id"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	TwoFactor     bool   `json:"two_factor_enabled"`
+	FirstName     string `json:"first_name"`
+	LastName      string `json:"last_name"`
+	FullName      string `json:"full_name"`
+	Address       string `json:"address"`
+	Birth_date    string `json:"birth_date"`
+	Contact       string `json:"contact_no"`
+	Deposit       uint   `json:"deposit"`
+}
+
+// ProfileUpdateInput only changes the fields that are present in the request.
+// Sending an empty birth_date or contact_no clears it.
+type ProfileUpdateInput struct {
+	FirstName  *string `json:"first_name" validate:"omitnil,notblank,max=255"`
+	LastName   *string `json:"last_name" validate:"omitnil,max=255"`
+	Address    *string `json:"address" validate:"omitnil,max=1000"`
+	Birth_date *string `json:"birth_date" validate:"omitnil,birthdate" example:"2000-01-31"`
+	Contact    *string `json:"contact_no" validate:"omitnil,phone"`
+}
+
+// ChangePasswordInput confirms the change with the current password. Users
+// who only sign in through a login provider set their first password the
+// same way they confirm deleting their account.
+type ChangePasswordInput struct {
+	CurrentPassword string `json:"current_password"`
+	Code            string `json:"code"`
+	NewPassword     string `json:"new_password" validate:"required,password"`
+}
+
+// DeleteAccountInput confirms the deletion with the password. Users who only
+// sign in through a login provider have none; they confirm with a recent
+// login through the provider, or with a two-factor code.
+type DeleteAccountInput struct {
+	Password string `json:"password"`
+	Code     string `json:"code"`
+}
+
+// @Summary Get my profile
+// @Description Returns the profile of the authenticated user
+// @Tags users
+// @Produce  json
+// @Success 200 {object} ProfileOutput "Profile"
+// @Failure 401 {object} utils.APIError "Invalid token"
+// @Security ApiKeyAuth
+// @Router /users/me [get]
+func (h *UserHandler) GetProfile(c echo.Context) error {
+	return c.JSON(http.StatusOK, newProfileOutput(*auth.CurrentUser(c)))
+}
+
+// @Summary Update my profile
+// @Description Updates the name, address, contact number or birth date of the authenticated user. Fields that are left out are not changed.
+// @Tags users
+// @Accept  json
+// @Produce  json
+// @Param   profileUpdateInput  body  ProfileUpdateInput  true  "Fields to change"
+// @Success 200 {object} ProfileOutput "Updated profile"
+// @Failure 400 {object} utils.APIError "Invalid input"
+// @Failure 500 {object} utils.APIError "Failed to update profile"
+// @Security ApiKeyAuth
+// @Router /users/me [patch]
+func (h *UserHandler) UpdateProfile(c echo.Context) error {
+	user := auth.CurrentUser(c)
+
+	input := new(ProfileUpdateInput)
+	if apiErr := utils.BindAndValidate(c, input); apiErr != nil {
+		return utils.HandleError(c, apiErr)
+	}
+
+	updates := map[string]interface{}{}
+	if input.FirstName != nil {
+		updates["first_name"] = strings.TrimSpace(*input.FirstName)
+	}
+	if input.LastName != nil {
+		updates["last_name"] = strings.TrimSpace(*input.LastName)
+	}
+	if input.Address != nil {
+		updates["address"] = strings.TrimSpace(*input.Address)
+	}
+	if input.Contact != nil {
+		updates["contact_no"] = utils.NormalizePhone(*input.Contact)
+	}
+	if input.Birth_date != nil {
+		if *input.Birth_date == "" {
+			updates["birth_date"] = nil
+		} else {
+			updates["birth_date"] = *input.Birth_date
+		}
+	}
+
+	updated, err := h.users.WithContext(c.Request().Context()).UpdateProfile(user.ID, updates)
+	if err != nil {
+		return utils.HandleError(c, utils.NewInternalError("Failed to update profile"))
+	}
+
+	return c.JSON(http.StatusOK, newProfileOutput(*updated))
+}
+
+// @Summary Change my password
+// @Description Changes the password of the authenticated user after checking the current password. Users without a password set their first one after a recent login through their provider or with a two-factor code. Other sessions are logged out.
+// @Tags users
+// @Accept  json
+// @Produce  json
+// @Param   changePasswordInput  body  ChangePasswordInput  true  "Current and new password, or a two-factor code for users without one"
+// @Success 200 {object} map[string]string "Password changed"
+// @Failure 400 {object} utils.APIError "Invalid input, incorrect current password or code"
+// @Failure 500 {object} utils.APIError "Failed to change password"
+// @Security ApiKeyAuth
+// @Router /users/me/password [post]
+func (h *UserHandler) ChangePassword(c echo.Context) error {
+	user := auth.CurrentUser(c)
+
+	input := new(ChangePasswordInput)
+	if apiErr := utils.BindAndValidate(c, input); apiErr != nil {
+		return utils.HandleError(c, apiErr)
+	}
+
+	if apiErr := h.confirmOwner(c, *user, input.CurrentPassword, input.Code, "Failed to change password"); apiErr != nil {
+		return utils.HandleError(c, apiErr)
+	}
+
+	hashedPassword, err := h.hasher.Hash(input.NewPassword)
+	if err != nil {
+		return utils.HandleError(c, utils.NewInternalError("Failed to change password"))
+	}
+
+	err = h.users.WithContext(c.Request().Context()).SetPassword(user.ID, hashedPassword, auth.CurrentClaims(c).SessionID)
+	if err != nil {
+		return utils.HandleError(c, utils.NewInternalError("Failed to change password"))
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{
+		"message": "Password changed",
+	})
+}
+
+// @Summary Delete my account
+// @Description Deletes the authenticated user's account. Personal data is removed, while rentals and payments are kept for the library's records. Users without a password confirm with a recent login through their provider or a two-factor code.
+// @Tags users
+// @Accept  json
+// @Produce  json
+// @Param   deleteAccountInput  body  DeleteAccountInput  true  "Current password, or a two-factor code for users without one"
+// @Success 200 {object} map[string]string "Account deleted"
+// @Failure 400 {object} utils.APIError "Incorrect password or code, or outstanding rentals"
+// @Failure 500 {object} utils.APIError "Failed to delete account"
+// @Security ApiKeyAuth
+// @Router /users/me [delete]
+func (h *UserHandler) DeleteAccount(c echo.Context) error {
+	user := auth.CurrentUser(c)
+
+	input := new(DeleteAccountInput)
+	if apiErr := utils.BindAndValidate(c, input); apiErr != nil {
+		return utils.HandleError(c, apiErr)
+	}
+	if apiErr := h.confirmOwner(c, *user, input.Password, input.Code, "Failed to delete account"); apiErr != nil {
+		return utils.HandleError(c, apiErr)
+	}
+
+	// Books still out on loan have to come back first
+	outstanding, err := h.rentals.WithContext(c.Request().Context()).HasOutstandingRentals(user.ID)
+	if err != nil {
+		return utils.HandleError(c, utils.NewInternalError("Failed to delete account"))
+	}
+	if outstanding {
+		return utils.HandleError(c, utils.NewBadRequestError("Please return all rented books before deleting your account"))
+	}
+
+	if err := h.users.WithContext(c.Request().Context()).DeleteAccount(user.ID); err != nil {
+		return utils.HandleError(c, utils.NewInternalError("Failed to delete account"))
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{
+		"message": "Account deleted",
+	})
+}
+
+// confirmOwner checks that whoever holds the session is the account owner
+// before a change that can't be undone. Users without a password confirm with
+// a login through their provider in the last ReauthenticationMaxAge or, once
+// they enabled it, a two-factor code.
+func (h *UserHandler) confirmOwner(c echo.Context, user models.User, password, code, failure string) *utils.APIError {
+	if user.Password != "" {
+		if match, err := h.hasher.Verify(user.Password, password); err != nil {
+			return utils.NewInternalError(failure)
+		} else if !match {
+			return utils.NewBadRequestError("Incorrect password")
+		}
+		return nil
+	}
+
+	if auth.CurrentClaims(c).AuthenticatedWithin(auth.AuthMethodFederated, auth.ReauthenticationMaxAge) {
+		return nil
+	}
+	if user.TOTPEnabledAt == nil {
+		return utils.NewBadRequestError("Please log in with your login provider again to confirm")
+	}
+	if code == "" {
+		return utils.NewBadRequestError("Please enter a two-factor code, or log in with your login provider again, to confirm")
+	}
+	if err := h.storeFor(c).TwoFactor().Verify(user, code); err != nil {
+		if errors.Is(err, auth.ErrInvalidTwoFactorCode) {
+			return utils.NewBadRequestError("Invalid two-factor code")
+		}
+		return utils.NewInternalError(failure)
+	}
+	return nil
+}
+
+func newProfileOutput(user models.User) ProfileOutput {
+	return ProfileOutput{
+		ID:            user.ID,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerifiedAt != nil,
+		TwoFactor:     user.TOTPEnabledAt != nil,
+		FirstName:     user.FirstName,
+		LastName:      user.LastName,
+		FullName:      strings.TrimSpace(user.FirstName + " " + user.LastName),
+		Address:       user.Address,
+		Birth_date:    formatDate(user.Birth_date),
+		Contact:       user.Contact,
+		Deposit:       user.Deposit,
+	}
+}
+
+// formatDate trims the time part Postgres adds when a DATE column is read
+// into a string.
+func formatDate(value string) string {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.Format("2006-01-02")
+	}
+	return value
+}
@@ -0,0 +1,158 @@
+package controllers
+
+import (
+	"finalp2/auth"
+	"finalp2/models"
+	"finalp2/services"
+	"finalp2/utils"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+type ReturnInput struct {
+	RentalDetailIDs []uint   `json:"rental_detail_ids" validate:"dive,gt=0"`
+	Barcodes        []string `json:"barcodes" validate:"dive,notblank"`
+}
+
+type CounterReturnInput struct {
+	UserID   uint     `json:"user_id"`
+	Barcodes []string `json:"barcodes" validate:"dive,notblank"`
+}
+
+type ReturnOutput struct {
+	Message  string         `json:"message"`
+	Returned []ReturnedItem `json:"returned"`
+}
+
+type ReturnedItem struct {
+	RentalDetailID uint                `json:"rental_detail_id"`
+	RentalID       uint                `json:"rental_id"`
+	BookID         uint                `json:"book_id"`
+	RentalStatus   models.RentalStatus `json:"rental_status"`
+}
+
+// Return godoc
+// @Summary      Return a book
+// @Description  Allows a user to return a book by ID that they have rented. When the user rented the same book more than once, the copy that is due first is returned.
+// @Tags         Rentals
+// @Accept       json
+// @Produce      json
+// @Param        id  path  int  true  "Book ID"
+// @Security     ApiKeyAuth
+// @Success      200  {object}  ReturnOutput  "Book returned successfully"
+// @Failure      400  {object}  utils.APIError  "Invalid book ID"
+// @Failure      404  {object}  utils.APIError  "Rental detail not found"
+// @Failure      409  {object}  utils.APIError  "The rental was changed by another request"
+// @Failure      500  {object}  utils.APIError  "Internal server error while processing return"
+// @Router       /users/return/{id} [post]
+func (h *RentalHandler) Return(c echo.Context) error {
+	bookID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return utils.HandleError(c, utils.NewBadRequestError("Invalid book ID"))
+	}
+
+	returned, err := h.rentals.WithContext(c.Request().Context()).ReturnBook(auth.CurrentUser(c).ID, uint(bookID))
+	return h.respondReturned(c, returned, err, "Book returned successfully")
+}
+
+// ReturnRentalDetail godoc
+// @Summary      Return a rented item
+// @Description  Returns a single rented item addressed by its rental detail ID.
+// @Tags         Rentals
+// @Produce      json
+// @Param        rental_detail_id  path  int  true  "Rental detail ID"
+// @Security     ApiKeyAuth
+// @Success      200  {object}  ReturnOutput  "Book returned successfully"
+// @Failure      400  {object}  utils.APIError  "Invalid rental detail ID or item already returned"
+// @Failure      404  {object}  utils.APIError  "Rental detail not found"
+// @Failure      409  {object}  utils.APIError  "The rental was changed by another request"
+// @Failure      500  {object}  utils.APIError  "Internal server error while processing return"
+// @Router       /users/returns/{rental_detail_id} [post]
+func (h *RentalHandler) ReturnRentalDetail(c echo.Context) error {
+	userID := auth.CurrentUser(c).ID
+	detailID, err := strconv.Atoi(c.Param("rental_detail_id"))
+	if err != nil {
+		return utils.HandleError(c, utils.NewBadRequestError("Invalid rental detail ID"))
+	}
+
+	returned, err := h.rentals.WithContext(c.Request().Context()).Return(&userID, []uint{uint(detailID)}, nil, userID)
+	return h.respondReturned(c, returned, err, "Book returned successfully")
+}
+
+// ReturnBatch godoc
+// @Summary      Return several books
+// @Description  Returns several rented items in one call, addressed by rental detail ID and/or copy barcode. Either every item is returned or none is.
+// @Tags         Rentals
+// @Accept       json
+// @Produce      json
+// @Param        returnInput  body  ReturnInput  true  "Items to return"
+// @Security     ApiKeyAuth
+// @Success      200  {object}  ReturnOutput  "Books returned successfully"
+// @Failure      400  {object}  utils.APIError  "Invalid input or item already returned"
+// @Failure      404  {object}  utils.APIError  "Rental detail or copy not found"
+// @Failure      409  {object}  utils.APIError  "The rental was changed by another request"
+// @Failure      500  {object}  utils.APIError  "Internal server error while processing return"
+// @Router       /users/returns [post]
+func (h *RentalHandler) ReturnBatch(c echo.Context) error {
+	userID := auth.CurrentUser(c).ID
+
+	var input ReturnInput
+	if apiErr := utils.BindAndValidate(c, &input); apiErr != nil {
+		return utils.HandleError(c, apiErr)
+	}
+	if len(input.RentalDetailIDs) == 0 && len(input.Barcodes) == 0 {
+		return utils.HandleError(c, utils.NewBadRequestError("Nothing to return"))
+	}
+
+	returned, err := h.rentals.WithContext(c.Request().Context()).Return(&userID, input.RentalDetailIDs, input.Barcodes, userID)
+	return h.respondReturned(c, returned, err, "Books returned successfully")
+}
+
+// CounterReturn godoc
+// @Summary      Return books at the counter
+// @Description  Lets library staff scan copies returned at the counter on behalf of a user. When user_id is given every copy must belong to that user's rentals.
+// @Tags         Staff
+// @Accept       json
+// @Produce      json
+// @Param        counterReturnInput  body  CounterReturnInput  true  "Scanned copies"
+// @Security     ApiKeyAuth
+// @Security     APIKey
+// @Success      200  {object}  ReturnOutput  "Books returned successfully"
+// @Failure      400  {object}  utils.APIError  "Invalid input or copy already returned"
+// @Failure      403  {object}  utils.APIError  "Staff access required"
+// @Failure      404  {object}  utils.APIError  "Copy not found"
+// @Failure      409  {object}  utils.APIError  "The rental was changed by another request"
+// @Failure      500  {object}  utils.APIError  "Internal server error while processing return"
+// @Router       /staff/returns [post]
+func (h *RentalHandler) CounterReturn(c echo.Context) error {
+	staffID := auth.CurrentUser(c).ID
+
+	var input CounterReturnInput
+	if apiErr := utils.BindAndValidate(c, &input); apiErr != nil {
+		return utils.HandleError(c, apiErr)
+	}
+	if len(input.Barcodes) == 0 {
+		return utils.HandleError(c, utils.NewBadRequestError("Nothing to return"))
+	}
+
+	var owner *uint
+	if input.UserID != 0 {
+		owner = &input.UserID
+	}
+	returned, err := h.rentals.WithContext(c.Request().Context()).Return(owner, nil, input.Barcodes, staffID)
+	return h.respondReturned(c, returned, err, "Books returned successfully")
+}
+
+func (h *RentalHandler) respondReturned(c echo.Context, returned []services.ReturnedItem, err error, message string) error {
+	if err != nil {
+		return utils.HandleError(c, utils.ToAPIError(err, "Internal server error while processing return"))
+	}
+
+	out := ReturnOutput{Message: message, Returned: make([]ReturnedItem, len(returned))}
+	for i, item := range returned {
+		out.Returned[i] = ReturnedItem(item)
+	}
+	return c.JSON(http.StatusOK, out)
+}
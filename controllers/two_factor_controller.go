@@ -0,0 +1,295 @@
+package controllers
+
+import (
+	"errors"
+	"finalp2/auth"
+	"finalp2/models"
+	"finalp2/utils"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+// TwoFactorChallenge is returned by login instead of tokens when the user has
+// two-factor authentication enabled.
+type TwoFactorChallenge struct {
+	TwoFactorRequired bool   `json:"two_factor_required"`
+	ChallengeToken    string `json:"challenge_token"`
+	ExpiresIn         int64  `json:"expires_in"`
+}
+
+type TwoFactorLoginInput struct {
+	ChallengeToken string `json:"challenge_token" validate:"required"`
+	// Code is a code from the authenticator app or a recovery code
+	Code string `json:"code" validate:"required"`
+}
+
+type TwoFactorCodeInput struct {
+	Code string `json:"code" validate:"required"`
+}
+
+// DisableTwoFactorInput confirms turning off two-factor authentication.
+// Users who only sign in through a login provider have no password to send.
+type DisableTwoFactorInput struct {
+	Password string `json:"password"`
+	Code     string `json:"code" validate:"required"`
+}
+
+type TwoFactorEnrollment struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+}
+
+type RecoveryCodes struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// @Summary Complete a two-factor login
+// @Description Exchanges the challenge token from login and a code from the authenticator app, or a recovery code, for access and refresh tokens
+// @Tags users
+// @Accept  json
+// @Produce  json
+// @Param   twoFactorLoginInput  body  TwoFactorLoginInput  true  "Challenge token and code"
+// @Success 200 {object} auth.TokenPair "Access and refresh tokens"
+// @Failure 400 {object} utils.APIError "Invalid input"
+// @Failure 401 {object} utils.APIError "Invalid or expired challenge, or invalid code"
+// @Failure 429 {object} utils.APIError "Too many failed attempts, see the Retry-After header"
+// @Failure 500 {object} utils.APIError "Failed to generate token"
+// @Router /users/login/2fa [post]
+func (h *UserHandler) LoginTwoFactor(c echo.Context) error {
+	input := new(TwoFactorLoginInput)
+	if apiErr := utils.BindAndValidate(c, input); apiErr != nil {
+		return utils.HandleError(c, apiErr)
+	}
+
+	// A wrong code leaves the challenge usable, the limiter stops guessing
+	userID, method, err := h.storeFor(c).ActionTokens().PeekTwoFactorChallenge(h.keys, input.ChallengeToken)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidActionToken) {
+			return utils.HandleError(c, utils.NewUnauthorizedError("Invalid or expired challenge, please log in again"))
+		}
+		return utils.HandleError(c, utils.NewInternalError("Failed to verify challenge"))
+	}
+
+	user, err := h.storeFor(c).Users().FindByID(userID)
+	if err != nil || user.DeletedAt != nil {
+		return utils.HandleError(c, utils.NewUnauthorizedError("Invalid or expired challenge, please log in again"))
+	}
+
+	ip := c.RealIP()
+	wait, err := h.limiter.RetryAfter(user.Email, ip)
+	if err != nil {
+		return utils.HandleError(c, utils.NewInternalError("Failed to check login attempts"))
+	}
+	if wait > 0 {
+		c.Response().Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		return utils.HandleError(c, utils.NewTooManyRequestsError("Too many failed login attempts, please try again later"))
+	}
+
+	if err := h.storeFor(c).TwoFactor().Verify(*user, input.Code); err != nil {
+		if errors.Is(err, auth.ErrInvalidTwoFactorCode) {
+			if err := h.limiter.RecordFailure(user.Email, ip); err != nil {
+				c.Logger().Errorf("recording failed login: %v", err)
+			}
+			return utils.HandleError(c, utils.NewUnauthorizedError("Invalid two-factor code"))
+		}
+		return utils.HandleError(c, utils.NewInternalError("Failed to verify code"))
+	}
+
+	if _, err := h.storeFor(c).ActionTokens().Consume(h.keys, input.ChallengeToken, auth.PurposeTwoFactorLogin); err != nil {
+		if errors.Is(err, auth.ErrInvalidActionToken) {
+			return utils.HandleError(c, utils.NewUnauthorizedError("Invalid or expired challenge, please log in again"))
+		}
+		return utils.HandleError(c, utils.NewInternalError("Failed to verify challenge"))
+	}
+
+	if err := h.limiter.RecordSuccess(user.Email); err != nil {
+		c.Logger().Errorf("clearing failed logins of user %d: %v", user.ID, err)
+	}
+
+	tokens, err := h.storeFor(c).Sessions().Issue(h.keys, *user, method, true)
+	if err != nil {
+		return utils.HandleError(c, utils.NewInternalError("Failed to generate token"))
+	}
+
+	return c.JSON(http.StatusOK, tokens)
+}
+
+// @Summary Start two-factor enrolment
+// @Description Generates a new TOTP secret for the authenticated user. Add it to an authenticator app, e.g. by showing the otpauth URI as a QR code, then confirm it with a code.
+// @Tags users
+// @Produce  json
+// @Success 200 {object} TwoFactorEnrollment "TOTP secret and otpauth URI"
+// @Failure 400 {object} utils.APIError "Two-factor authentication already enabled"
+// @Failure 500 {object} utils.APIError "Failed to start enrolment"
+// @Security ApiKeyAuth
+// @Router /users/me/2fa/enroll [post]
+func (h *UserHandler) EnrollTwoFactor(c echo.Context) error {
+	user := auth.CurrentUser(c)
+
+	if user.TOTPEnabledAt != nil {
+		return utils.HandleError(c, utils.NewBadRequestError("Two-factor authentication is already enabled"))
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		return utils.HandleError(c, utils.NewInternalError("Failed to start enrolment"))
+	}
+
+	err = h.storeFor(c).Users().Update(user.ID, map[string]interface{}{
+		"totp_secret":    secret,
+		"totp_last_step": 0,
+	})
+	if err != nil {
+		return utils.HandleError(c, utils.NewInternalError("Failed to start enrolment"))
+	}
+
+	return c.JSON(http.StatusOK, TwoFactorEnrollment{
+		Secret:     secret,
+		OTPAuthURI: auth.TOTPURI(auth.TOTPIssuer, user.Email, secret),
+	})
+}
+
+// @Summary Confirm two-factor enrolment
+// @Description Enables two-factor authentication once the user proves the authenticator app works. Returns recovery codes that are shown only once.
+// @Tags users
+// @Accept  json
+// @Produce  json
+// @Param   twoFactorCodeInput  body  TwoFactorCodeInput  true  "Code from the authenticator app"
+// @Success 200 {object} RecoveryCodes "Recovery codes"
+// @Failure 400 {object} utils.APIError "Invalid code, enrolment not started or already enabled"
+// @Failure 500 {object} utils.APIError "Failed to enable two-factor authentication"
+// @Security ApiKeyAuth
+// @Router /users/me/2fa/confirm [post]
+func (h *UserHandler) ConfirmTwoFactor(c echo.Context) error {
+	user := auth.CurrentUser(c)
+
+	input := new(TwoFactorCodeInput)
+	if apiErr := utils.BindAndValidate(c, input); apiErr != nil {
+		return utils.HandleError(c, apiErr)
+	}
+
+	if user.TOTPEnabledAt != nil {
+		return utils.HandleError(c, utils.NewBadRequestError("Two-factor authentication is already enabled"))
+	}
+	if user.TOTPSecret == "" {
+		return utils.HandleError(c, utils.NewBadRequestError("Please start two-factor enrolment first"))
+	}
+
+	if err := h.storeFor(c).TwoFactor().Verify(*user, input.Code); err != nil {
+		if errors.Is(err, auth.ErrInvalidTwoFactorCode) {
+			return utils.HandleError(c, utils.NewBadRequestError("Invalid two-factor code"))
+		}
+		return utils.HandleError(c, utils.NewInternalError("Failed to enable two-factor authentication"))
+	}
+
+	codes, err := h.users.WithContext(c.Request().Context()).EnableTwoFactor(user.ID)
+	if err != nil {
+		return utils.HandleError(c, utils.NewInternalError("Failed to enable two-factor authentication"))
+	}
+
+	return c.JSON(http.StatusOK, RecoveryCodes{RecoveryCodes: codes})
+}
+
+// @Summary Disable two-factor authentication
+// @Description Turns off two-factor authentication after checking the password and a current code. Users without a password only need the code. Admins must keep it enabled.
+// @Tags users
+// @Accept  json
+// @Produce  json
+// @Param   disableTwoFactorInput  body  DisableTwoFactorInput  true  "Password and code"
+// @Success 200 {object} map[string]string "Two-factor authentication disabled"
+// @Failure 400 {object} utils.APIError "Invalid input, password or code"
+// @Failure 403 {object} utils.APIError "Admins must keep two-factor authentication enabled"
+// @Failure 500 {object} utils.APIError "Failed to disable two-factor authentication"
+// @Security ApiKeyAuth
+// @Router /users/me/2fa/disable [post]
+func (h *UserHandler) DisableTwoFactor(c echo.Context) error {
+	user := auth.CurrentUser(c)
+
+	input := new(DisableTwoFactorInput)
+	if apiErr := utils.BindAndValidate(c, input); apiErr != nil {
+		return utils.HandleError(c, apiErr)
+	}
+
+	if user.TOTPEnabledAt == nil {
+		return utils.HandleError(c, utils.NewBadRequestError("Two-factor authentication is not enabled"))
+	}
+	if user.Role == models.RoleAdmin {
+		return utils.HandleError(c, utils.NewForbiddenError("Admins must keep two-factor authentication enabled"))
+	}
+	// Without a password the code is the only thing to confirm with
+	if user.Password != "" {
+		if match, err := h.hasher.Verify(user.Password, input.Password); err != nil {
+			return utils.HandleError(c, utils.NewInternalError("Failed to disable two-factor authentication"))
+		} else if !match {
+			return utils.HandleError(c, utils.NewBadRequestError("Incorrect password"))
+		}
+	}
+	if err := h.storeFor(c).TwoFactor().Verify(*user, input.Code); err != nil {
+		if errors.Is(err, auth.ErrInvalidTwoFactorCode) {
+			return utils.HandleError(c, utils.NewBadRequestError("Invalid two-factor code"))
+		}
+		return utils.HandleError(c, utils.NewInternalError("Failed to disable two-factor authentication"))
+	}
+
+	if err := h.users.WithContext(c.Request().Context()).DisableTwoFactor(user.ID); err != nil {
+		return utils.HandleError(c, utils.NewInternalError("Failed to disable two-factor authentication"))
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{
+		"message": "Two-factor authentication disabled",
+	})
+}
+
+// @Summary Regenerate recovery codes
+// @Description Replaces all recovery codes of the authenticated user after checking a current code. The old codes stop working.
+// @Tags users
+// @Accept  json
+// @Produce  json
+// @Param   twoFactorCodeInput  body  TwoFactorCodeInput  true  "Code from the authenticator app"
+// @Success 200 {object} RecoveryCodes "New recovery codes"
+// @Failure 400 {object} utils.APIError "Invalid code or two-factor authentication not enabled"
+// @Failure 500 {object} utils.APIError "Failed to generate recovery codes"
+// @Security ApiKeyAuth
+// @Router /users/me/2fa/recovery-codes [post]
+func (h *UserHandler) RegenerateRecoveryCodes(c echo.Context) error {
+	user := auth.CurrentUser(c)
+
+	input := new(TwoFactorCodeInput)
+	if apiErr := utils.BindAndValidate(c, input); apiErr != nil {
+		return utils.HandleError(c, apiErr)
+	}
+
+	if user.TOTPEnabledAt == nil {
+		return utils.HandleError(c, utils.NewBadRequestError("Two-factor authentication is not enabled"))
+	}
+	if err := h.storeFor(c).TwoFactor().Verify(*user, input.Code); err != nil {
+		if errors.Is(err, auth.ErrInvalidTwoFactorCode) {
+			return utils.HandleError(c, utils.NewBadRequestError("Invalid two-factor code"))
+		}
+		return utils.HandleError(c, utils.NewInternalError("Failed to generate recovery codes"))
+	}
+
+	codes, err := h.storeFor(c).TwoFactor().GenerateRecoveryCodes(user.ID)
+	if err != nil {
+		return utils.HandleError(c, utils.NewInternalError("Failed to generate recovery codes"))
+	}
+
+	return c.JSON(http.StatusOK, RecoveryCodes{RecoveryCodes: codes})
+}
+
+// respondTwoFactorChallenge answers a successful first login step, made with
+// method, of a user with two-factor authentication enabled.
+func (h *UserHandler) respondTwoFactorChallenge(c echo.Context, user models.User, method string) error {
+	challenge, err := h.storeFor(c).ActionTokens().IssueTwoFactorChallenge(h.keys, user, method)
+	if err != nil {
+		return utils.HandleError(c, utils.NewInternalError("Failed to generate token"))
+	}
+	return c.JSON(http.StatusOK, TwoFactorChallenge{
+		TwoFactorRequired: true,
+		ChallengeToken:    challenge,
+		ExpiresIn:         int64(auth.TwoFactorChallengeTTL.Seconds()),
+	})
+}
@@ -1,63 +1,138 @@
 package controllers
 
 import (
+	"errors"
+	"finalp2/auth"
+	"finalp2/config"
+	"finalp2/mailer"
 	"finalp2/models"
+	"finalp2/oidc"
+	"finalp2/repository"
+	"finalp2/services"
 	"finalp2/utils"
+	"math"
 	"net/http"
-	"time"
+	"strconv"
+	"strings"
 
-	"github.com/golang-jwt/jwt"
 	"github.com/labstack/echo/v4"
-	"golang.org/x/crypto/bcrypt"
-	"gorm.io/gorm"
 )
 
+// UserHandler serves registration, login and everything users manage about
+// their own account, plus the admin endpoints for accounts. Single lookups
+// and updates go to the store's repositories, changes that span several
+// tables to the UserService.
+type UserHandler struct {
+	store     repository.Store
+	users     *services.UserService
+	rentals   *services.RentalService
+	cfg       *config.Config
+	keys      *auth.KeyManager
+	mail      mailer.Mailer
+	limiter   *auth.LoginLimiter
+	providers *oidc.Registry
+	hasher    *auth.PasswordHasher
+}
+
+func NewUserHandler(store repository.Store, users *services.UserService, rentals *services.RentalService, cfg *config.Config, keys *auth.KeyManager, mail mailer.Mailer, limiter *auth.LoginLimiter, providers *oidc.Registry, hasher *auth.PasswordHasher) *UserHandler {
+	return &UserHandler{
+		store:     store,
+		users:     users,
+		rentals:   rentals,
+		cfg:       cfg,
+		keys:      keys,
+		mail:      mail,
+		limiter:   limiter,
+		providers: providers,
+		hasher:    hasher,
+	}
+}
+
+// storeFor returns the store bound to the request, so queries stop when the
+// request times out or the client goes away.
+func (h *UserHandler) storeFor(c echo.Context) repository.Store {
+	return h.store.WithContext(c.Request().Context())
+}
+
 type UserInput struct {
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	Email    string `json:"email" validate:"required,email"`
+	Password string `json:"password" validate:"required"`
 }
 
-type UserOutput struct {
-	ID      		uint   `json:"user_id"`  
-	Email           string `json:"email"`
-	FullName    	string `json:"full_name"`                  
-	Address 		string `json:"address"`
-	Birth_date		string `json:"birth_date"`
-	Contact			string `json:"contact_no"`
-	Deposit			uint   `json:"deposit"`
+func (i *UserInput) Normalize() {
+	i.Email = utils.NormalizeEmail(i.Email)
 }
 
+// RegisterInput is what a new user may set about themselves; the deposit,
+// role and verification state are managed by the system.
+type RegisterInput struct {
+	Email      string `json:"email" validate:"required,email,max=255"`
+	Password   string `json:"password" validate:"required,password"`
+	FirstName  string `json:"first_name" validate:"required,notblank,max=255"`
+	LastName   string `json:"last_name" validate:"max=255"`
+	Birth_date string `json:"birth_date" validate:"required,birthdate" example:"2000-01-31"`
+	Address    string `json:"address" validate:"max=1000"`
+	Contact    string `json:"contact_no" validate:"phone"`
+}
+
+func (i *RegisterInput) Normalize() {
+	i.Email = utils.NormalizeEmail(i.Email)
+}
+
+type UserOutput struct {
+	ID         uint   `json:"user_id"`
+	Email      string `json:"email"`
+	FullName   string `json:"full_name"`
+	Address    string `json:"address"`
+	Birth_date string `json:"birth_date"`
+	Contact    string `json:"contact_no"`
+	Deposit    uint   `json:"deposit"`
+}
 
 // @Summary Register a new user
-// @Description Registers a new user with an email and password
+// @Description Registers a new user with an email and password and sends an email verification link
 // @Tags users
 // @Accept  json
 // @Produce  json
-// @Param   userInput  body  UserInput  true  "User Registration Input"
-// @Success 200 {object} models.User "User object containing ID, Email, and other fields"
+// @Param   registerInput  body  RegisterInput  true  "User Registration Input"
+// @Success 200 {object} UserOutput "The created user"
 // @Failure 400 {object} utils.APIError "Invalid input or failed to create user"
+// @Failure 500 {object} utils.APIError "Failed to hash the password"
 // @Router /users/register [post]
-func RegisterUser(c echo.Context) error {
-	// Bind the input JSON to User
-	user := new(models.User)
-	if err := c.Bind(user); err != nil {
-		return utils.HandleError(c, utils.NewBadRequestError("Invalid input"))
+func (h *UserHandler) RegisterUser(c echo.Context) error {
+	input := new(RegisterInput)
+	if apiErr := utils.BindAndValidate(c, input); apiErr != nil {
+		return utils.HandleError(c, apiErr)
 	}
 
-	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte(user.Password), 16)
-	user.Password = string(hashedPassword)
+	hashedPassword, err := h.hasher.Hash(input.Password)
+	if err != nil {
+		return utils.HandleError(c, utils.NewInternalError("Failed to create user."))
+	}
 
-	db := c.Get("db").(*gorm.DB)
+	user := &models.User{
+		Email:      input.Email,
+		Password:   hashedPassword,
+		FirstName:  strings.TrimSpace(input.FirstName),
+		LastName:   strings.TrimSpace(input.LastName),
+		Birth_date: input.Birth_date,
+		Address:    strings.TrimSpace(input.Address),
+		Contact:    utils.NormalizePhone(input.Contact),
+	}
 
-	// Save the user to db
-	if err := db.Create(&user).Error; err != nil {
+	if err := h.storeFor(c).Users().Create(user); err != nil {
 		return utils.HandleError(c, utils.NewBadRequestError("Failed to create user."))
 	}
 
+	// The account works without it, so a failed email does not fail registration
+	if err := h.sendVerificationEmail(c, *user); err != nil {
+		c.Logger().Errorf("sending verification email to user %d: %v", user.ID, err)
+	}
+
 	out := new(UserOutput)
 	out.ID = user.ID
 	out.Email = user.Email
-	out.FullName = user.FirstName + " " + user.LastName
+	out.FullName = strings.TrimSpace(user.FirstName + " " + user.LastName)
 	out.Address = user.Address
 	out.Birth_date = user.Birth_date
 	out.Contact = user.Contact
@@ -66,53 +141,166 @@ func RegisterUser(c echo.Context) error {
 	return c.JSON(http.StatusOK, out)
 }
 
-
 // @Summary Login a user
-// @Description Logs in a user with an email and password, returns a JWT token
+// @Description Logs in a user with an email and password, returns a short-lived access token and a refresh token. Repeated failures for an account or from an IP address slow down further attempts and eventually lock them temporarily.
 // @Tags users
 // @Accept  json
 // @Produce  json
 // @Param   userInput  body  UserInput  true  "User Login Input"
-// @Success 200 {object} map[string]string "JWT Token"
-// @Failure 400 {object} utils.APIError "Invalid input or incorrect password"
-// @Failure 404 {object} utils.APIError "Email not found"
+// @Success 200 {object} auth.TokenPair "Access and refresh tokens, or a TwoFactorChallenge when two-factor authentication is enabled"
+// @Failure 400 {object} utils.APIError "Invalid input"
+// @Failure 401 {object} utils.APIError "Invalid email or password"
+// @Failure 403 {object} utils.APIError "Email not verified"
+// @Failure 429 {object} utils.APIError "Too many failed attempts, see the Retry-After header"
 // @Failure 500 {object} utils.APIError "Failed to generate token"
 // @Router /users/login [post]
-func LoginUser(c echo.Context) error {
-	db := c.Get("db").(*gorm.DB)
-
+func (h *UserHandler) LoginUser(c echo.Context) error {
 	input := new(UserInput)
-	if err := c.Bind(input); err != nil {
-		return utils.HandleError(c, utils.NewBadRequestError("Invalid input"))
+	if apiErr := utils.BindAndValidate(c, input); apiErr != nil {
+		return utils.HandleError(c, apiErr)
 	}
 
-	dbUser := new(models.User)
-	result := db.Where("email = ?", input.Email).First(&dbUser)
-	if result.Error != nil {
-		return utils.HandleError(c, utils.NewNotFoundError("Email not found"))
+	ip := c.RealIP()
+	wait, err := h.limiter.RetryAfter(input.Email, ip)
+	if err != nil {
+		return utils.HandleError(c, utils.NewInternalError("Failed to check login attempts"))
+	}
+	if wait > 0 {
+		c.Response().Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		return utils.HandleError(c, utils.NewTooManyRequestsError("Too many failed login attempts, please try again later"))
 	}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(dbUser.Password), []byte(input.Password)); err != nil {
-		return utils.HandleError(c, utils.NewBadRequestError("Incorrect password"))
+	// Unknown emails and wrong passwords look the same to the client
+	invalidCredentials := func() error {
+		if err := h.limiter.RecordFailure(input.Email, ip); err != nil {
+			c.Logger().Errorf("recording failed login: %v", err)
+		}
+		return utils.HandleError(c, utils.NewUnauthorizedError("Invalid email or password"))
 	}
 
-	// JWT Token
-	claims := jwt.MapClaims{
-		"user_id":    dbUser.ID,
-		"email":      dbUser.Email,
-		"exp":        time.Now().Add(time.Hour * 72).Unix(), // Token expiry
+	dbUser, err := h.storeFor(c).Users().FindActiveByEmail(input.Email)
+	if errors.Is(err, repository.ErrNotFound) {
+		// Spend the same time as a real password check
+		h.hasher.VerifyDummy(input.Password)
+		return invalidCredentials()
+	}
+	if err != nil {
+		return utils.HandleError(c, utils.NewInternalError("Failed to log in"))
 	}
 
-	// Create token with claims
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	signedToken, err := token.SignedString([]byte("secret"))
+	match, err := h.hasher.Verify(dbUser.Password, input.Password)
 	if err != nil {
+		c.Logger().Errorf("checking password of user %d: %v", dbUser.ID, err)
+		return utils.HandleError(c, utils.NewInternalError("Failed to log in"))
+	}
+	if !match {
+		return invalidCredentials()
+	}
+	h.rehashPassword(c, dbUser, input.Password)
+
+	if h.cfg.Auth.RequireEmailVerification && dbUser.EmailVerifiedAt == nil {
+		return utils.HandleError(c, utils.NewForbiddenError("Please verify your email address before logging in"))
+	}
+
+	// With two-factor enabled the password only earns a challenge; failed
+	// logins are cleared once the second step succeeds
+	if dbUser.TOTPEnabledAt != nil {
+		return h.respondTwoFactorChallenge(c, *dbUser, auth.AuthMethodPassword)
+	}
+
+	if err := h.limiter.RecordSuccess(input.Email); err != nil {
+		c.Logger().Errorf("clearing failed logins of user %d: %v", dbUser.ID, err)
+	}
+
+	tokens, err := h.storeFor(c).Sessions().Issue(h.keys, *dbUser, auth.AuthMethodPassword, false)
+	if err != nil {
+		return utils.HandleError(c, utils.NewInternalError("Failed to generate token"))
+	}
+
+	return c.JSON(http.StatusOK, tokens)
+}
+
+type RefreshInput struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+// @Summary Refresh tokens
+// @Description Exchanges a refresh token for a new access and refresh token. Each refresh token can only be used once; reusing one revokes the whole session.
+// @Tags users
+// @Accept  json
+// @Produce  json
+// @Param   refreshInput  body  RefreshInput  true  "Refresh token"
+// @Success 200 {object} auth.TokenPair "Access and refresh tokens"
+// @Failure 400 {object} utils.APIError "Invalid input"
+// @Failure 401 {object} utils.APIError "Invalid, expired, reused or revoked refresh token"
+// @Failure 500 {object} utils.APIError "Failed to generate token"
+// @Router /users/refresh [post]
+func (h *UserHandler) RefreshToken(c echo.Context) error {
+	input := new(RefreshInput)
+	if apiErr := utils.BindAndValidate(c, input); apiErr != nil {
+		return utils.HandleError(c, apiErr)
+	}
+
+	tokens, err := h.storeFor(c).Sessions().Refresh(h.keys, input.RefreshToken)
+	switch {
+	case errors.Is(err, auth.ErrRefreshTokenReused):
+		return utils.HandleError(c, utils.NewUnauthorizedError("Refresh token was already used, please log in again"))
+	case errors.Is(err, auth.ErrSessionRevoked):
+		return utils.HandleError(c, utils.NewUnauthorizedError("Session has been revoked, please log in again"))
+	case errors.Is(err, auth.ErrInvalidRefreshToken):
+		return utils.HandleError(c, utils.NewUnauthorizedError("Invalid or expired refresh token"))
+	case err != nil:
 		return utils.HandleError(c, utils.NewInternalError("Failed to generate token"))
 	}
-	dbUser.JwtToken = signedToken
 
-	db.Save(&dbUser)
+	return c.JSON(http.StatusOK, tokens)
+}
+
+// @Summary Logout
+// @Description Revokes the current session. The access token and all refresh tokens of the session stop working.
+// @Tags users
+// @Produce  json
+// @Success 200 {object} map[string]string "Logged out"
+// @Failure 401 {object} utils.APIError "Invalid token"
+// @Failure 500 {object} utils.APIError "Failed to log out"
+// @Security ApiKeyAuth
+// @Router /users/logout [post]
+func (h *UserHandler) Logout(c echo.Context) error {
+	if err := h.storeFor(c).Sessions().Revoke(auth.CurrentClaims(c).SessionID); err != nil {
+		return utils.HandleError(c, utils.NewInternalError("Failed to log out"))
+	}
+
 	return c.JSON(http.StatusOK, echo.Map{
-		"token": dbUser.JwtToken,
+		"message": "Logged out",
 	})
 }
+
+// @Summary JSON Web Key Set
+// @Description Public keys that can be used to verify the access tokens issued by this service
+// @Tags users
+// @Produce  json
+// @Success 200 {object} auth.JSONWebKeySet "Public signing keys"
+// @Router /.well-known/jwks.json [get]
+func (h *UserHandler) JWKS(c echo.Context) error {
+	return c.JSON(http.StatusOK, h.keys.JWKS())
+}
+
+// rehashPassword upgrades a stored hash made with older settings while the
+// plain password is at hand. Failing to do so does not fail the login.
+func (h *UserHandler) rehashPassword(c echo.Context, user *models.User, password string) {
+	if !h.hasher.NeedsRehash(user.Password) {
+		return
+	}
+	hash, err := h.hasher.Hash(password)
+	replaced := false
+	if err == nil {
+		replaced, err = h.storeFor(c).Users().ReplacePasswordHash(user.ID, user.Password, hash)
+	}
+	if err != nil {
+		c.Logger().Errorf("rehashing password of user %d: %v", user.ID, err)
+		return
+	}
+	if replaced {
+		user.Password = hash
+	}
+}
@@ -3,27 +3,34 @@ package helper
 import (
 	"bytes"
 	"encoding/json"
+	"finalp2/config"
 	"finalp2/models"
 	"net/http"
 )
 
+// DefaultXenditAPIURL is used when the config leaves the API URL empty.
+const DefaultXenditAPIURL = "https://api.xendit.co"
+
 type Invoice struct {
 	ID         string `json:"id"`
 	InvoiceUrl string `json:"invoice_url"`
 }
 
-func CreateInvoice(product models.Rental, customer models.User, books []models.Book) (*Invoice, error) {
-	apiKey := "xnd_development_K6nwB5ulAFPVXsOOKjan9yZUhstq81qZ5yz3CT5gY1vx3Aof8VwuffIcyHjfm"
-	apiUrl := "https://api.xendit.co/v2/invoices"
+func CreateInvoice(cfg config.XenditConfig, product models.Rental, customer models.User, books []models.Book) (*Invoice, error) {
+	apiUrl := cfg.APIURL
+	if apiUrl == "" {
+		apiUrl = DefaultXenditAPIURL
+	}
+	apiUrl += "/v2/invoices"
 
 	items := []map[string]interface{}{}
 
 	// Iterate over the books and add each to the items array
 	for _, book := range books {
 		item := map[string]interface{}{
-			"name":     book.Title, 
+			"name":     book.Title,
 			"price":    book.Price,
-			"quantity": 1, 
+			"quantity": 1,
 		}
 		items = append(items, item)
 	}
@@ -38,7 +45,7 @@ func CreateInvoice(product models.Rental, customer models.User, books []models.B
 			"email": customer.Email,
 		},
 		"currency": "IDR",
-		"items": items,
+		"items":    items,
 	}
 
 	reqBody, err := json.Marshal(bodyRequest)
@@ -52,7 +59,7 @@ func CreateInvoice(product models.Rental, customer models.User, books []models.B
 		return nil, err
 	}
 
-	request.SetBasicAuth(apiKey, "")
+	request.SetBasicAuth(cfg.APIKey, "")
 	request.Header.Set("Content-Type", "application/json")
 
 	response, err := client.Do(request)
@@ -70,3 +77,12 @@ func CreateInvoice(product models.Rental, customer models.User, books []models.B
 	return &resInvoice, nil
 
 }
+
+// XenditInvoicer creates invoices with the Xendit API.
+type XenditInvoicer struct {
+	Config config.XenditConfig
+}
+
+func (x XenditInvoicer) CreateInvoice(rental models.Rental, customer models.User, books []models.Book) (*Invoice, error) {
+	return CreateInvoice(x.Config, rental, customer, books)
+}
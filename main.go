@@ -2,8 +2,12 @@ package main
 
 import (
 	"context"
+	"errors"
+	"finalp2/auth"
 	"finalp2/config"
+	"finalp2/mailer"
 	"finalp2/middlewares"
+	"finalp2/oidc"
 	"finalp2/routes"
 	"finalp2/utils"
 	"log"
@@ -60,8 +64,58 @@ func customHTTPErrorHandler(err error, c echo.Context, logger *logrus.Logger) {
 // @securityDefinitions.apiKey BearerAuth
 // @in header
 // @name Authorization
+
+// @securityDefinitions.apiKey APIKey
+// @in header
+// @name X-API-Key
 func main() {
-	db := config.InitDB()
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+	log.Printf("Configuration:\n%s", cfg)
+
+	db, err := config.InitDB(cfg.Database)
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+
+	if len(os.Args) > 1 {
+		if err := runCommand(cfg, db, os.Args[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if err := migrateOnStart(db, cfg.Database.MigrateOnStart); err != nil {
+		log.Fatalf("Failed to migrate the database: %v", err)
+	}
+
+	keys, err := auth.NewKeyManager(cfg.JWT.KeyConfigs(), cfg.JWT.ActiveKID)
+	if err != nil {
+		log.Fatalf("Failed to load JWT signing keys: %v", err)
+	}
+
+	mail, err := mailer.New(cfg.Mail)
+	if err != nil {
+		log.Fatalf("Failed to set up mailer: %v", err)
+	}
+
+	passwordHasher, err := cfg.Password.Hasher()
+	if err != nil {
+		log.Fatalf("Failed to set up password hashing: %v", err)
+	}
+
+	attemptStore, err := auth.NewAttemptStore(db, cfg.Auth.LoginAttemptStore)
+	if err != nil {
+		log.Fatalf("Failed to set up login attempt store: %v", err)
+	}
+	loginLimiter := auth.NewLoginLimiter(attemptStore)
+
+	oidcProviders, err := oidc.NewRegistry(cfg.Auth.OIDCProviders)
+	if err != nil {
+		log.Fatalf("Failed to load OIDC providers: %v", err)
+	}
 
 	e := echo.New()
 
@@ -74,11 +128,12 @@ func main() {
 		FullTimestamp: true,
 	})
 
-	// Set log Level using Logrus
-	logger.SetLevel(logrus.WarnLevel)
+	// Set log Level using Logrus, the level was checked when loading the config
+	level, _ := logrus.ParseLevel(cfg.Log.Level)
+	logger.SetLevel(level)
 
 	//Output Destination
-	file, err := os.OpenFile("app.log", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	file, err := os.OpenFile(cfg.Log.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
 	if err == nil {
 		logger.SetOutput(file) //mencatat log ke file
 	} else {
@@ -100,41 +155,36 @@ func main() {
 	//middleware logrus
 	e.Use(middlewares.LogrusMiddleware(logger))
 
-	routes.SetupRoutes(e, db)
-
-	// Handle graceful shutdown
-	go func() {
-		if err := e.Start(":8080"); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("shutting down the server: %v", err)
-		}
-	}()
-
-	// Wait for an interrupt signal to gracefully shutdown the server
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
-
-	log.Println("Shutting down the server...")
+	health := routes.SetupRoutes(e, db, cfg, keys, mail, loginLimiter, oidcProviders, passwordHasher)
 
-	// Properly shutdown the Echo server
-	if err := e.Shutdown(context.Background()); err != nil {
-		log.Fatalf("Error shutting down the server: %v", err)
-	}
-
-	// Close the database connection
 	sqlDB, err := db.DB()
 	if err != nil {
 		log.Fatalf("Failed to get SQL DB from GORM: %v", err)
 	}
-	if err := sqlDB.Close(); err != nil {
-		log.Fatalf("Failed to close the database connection: %v", err)
-	}
 
-	log.Println("Server shut down gracefully.")
+	srv := &server{
+		echo:            e,
+		health:          health,
+		drainDelay:      cfg.Server.DrainDelay,
+		shutdownTimeout: cfg.Server.ShutdownTimeout,
+	}
+	srv.goWorker("expired record cleanup", func(ctx context.Context) {
+		pruneExpired(ctx, db, cleanupInterval)
+	})
+	// The workers are stopped before these close
+	if file != nil {
+		srv.onShutdown("log file", func() error {
+			return errors.Join(file.Sync(), file.Close())
+		})
+	}
+	srv.onShutdown("database connection", sqlDB.Close)
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080" // Default port if not specified
+	// Run until an interrupt signal, then shut down gracefully
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	if err := srv.run(ctx, ":"+cfg.Server.Port); err != nil {
+		log.Fatalf("Server stopped: %v", err)
 	}
-	e.Logger.Fatal(e.Start(":"+port))
-}
\ No newline at end of file
+
+	log.Println("Server shut down gracefully.")
+}
@@ -0,0 +1,97 @@
+package middlewares
+
+import (
+	"errors"
+	"finalp2/auth"
+	"finalp2/models"
+	"finalp2/repository"
+	"finalp2/utils"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// JWTAuth validates the bearer access token against the configured keys,
+// rejects tokens whose session was revoked and loads the authenticated user
+// into the context, see auth.CurrentUser.
+func JWTAuth(db *gorm.DB, keys *auth.KeyManager) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			return authenticateJWT(c, db, keys, next)
+		}
+	}
+}
+
+// JWTOrAPIKey works like JWTAuth but also accepts an API key with the given
+// scope in the X-API-Key header. Routes without it only take bearer tokens.
+func JWTOrAPIKey(db *gorm.DB, keys *auth.KeyManager, scope string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			raw := c.Request().Header.Get(auth.APIKeyHeader)
+			if raw == "" {
+				return authenticateJWT(c, db, keys, next)
+			}
+
+			db := db.WithContext(c.Request().Context())
+			key, err := auth.AuthenticateAPIKey(db, raw)
+			if err != nil {
+				if errors.Is(err, auth.ErrInvalidAPIKey) {
+					return utils.HandleError(c, utils.NewUnauthorizedError("Invalid, expired or revoked API key"))
+				}
+				return utils.HandleError(c, utils.NewInternalError("Failed to verify API key"))
+			}
+			if !key.HasScope(scope) {
+				return utils.HandleError(c, utils.NewForbiddenError("API key lacks the "+scope+" scope"))
+			}
+
+			user, apiErr := loadUser(db, key.UserID)
+			if apiErr != nil {
+				return utils.HandleError(c, apiErr)
+			}
+
+			auth.SetCurrentUser(c, user, nil)
+			return next(c)
+		}
+	}
+}
+
+func authenticateJWT(c echo.Context, db *gorm.DB, keys *auth.KeyManager, next echo.HandlerFunc) error {
+	header := c.Request().Header.Get(echo.HeaderAuthorization)
+	tokenString, found := strings.CutPrefix(header, "Bearer ")
+	if !found || tokenString == "" {
+		return utils.HandleError(c, utils.NewUnauthorizedError("Missing or malformed token"))
+	}
+
+	db = db.WithContext(c.Request().Context())
+	claims, err := auth.ParseAccessToken(db, keys, tokenString)
+	if err != nil {
+		if errors.Is(err, auth.ErrSessionRevoked) {
+			return utils.HandleError(c, utils.NewUnauthorizedError("Token has been revoked"))
+		}
+		if errors.Is(err, auth.ErrInvalidToken) {
+			return utils.HandleError(c, utils.NewUnauthorizedError("Invalid or expired token"))
+		}
+		return utils.HandleError(c, utils.NewInternalError("Failed to verify token"))
+	}
+
+	// Load the user once so handlers don't have to
+	user, apiErr := loadUser(db, claims.UserID)
+	if apiErr != nil {
+		return utils.HandleError(c, apiErr)
+	}
+
+	auth.SetCurrentUser(c, user, claims)
+	return next(c)
+}
+
+func loadUser(db *gorm.DB, userID uint) (*models.User, *utils.APIError) {
+	user, err := repository.NewUserRepository(db).FindByID(userID)
+	if errors.Is(err, repository.ErrNotFound) || (err == nil && user.DeletedAt != nil) {
+		return nil, utils.NewUnauthorizedError("User no longer exists")
+	}
+	if err != nil {
+		return nil, utils.NewInternalError("Failed to load user")
+	}
+	return user, nil
+}
@@ -0,0 +1,181 @@
+package middlewares
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"finalp2/auth"
+	"finalp2/models"
+	"finalp2/utils"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	IdempotencyKeyHeader = "Idempotency-Key"
+	idempotencyKeyTTL    = 24 * time.Hour
+	maxIdempotencyKeyLen = 255
+
+	// defaultIdempotencyLockTimeout is how long a key stays taken by a
+	// request that never finished when requests have no timeout
+	defaultIdempotencyLockTimeout = time.Minute
+)
+
+// responseRecorder keeps a copy of everything written to the response so it
+// can be stored for replays.
+type responseRecorder struct {
+	http.ResponseWriter
+	body bytes.Buffer
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+// Idempotency makes a mutating endpoint safe to retry. When the client sends an
+// Idempotency-Key header, the first response for that key and user is stored
+// and replayed for every retry. Reusing a key with a different request is
+// rejected. A key whose request is still unfinished after requestTimeout is
+// taken to belong to a crashed request and is free again. It must run after
+// the JWT middleware.
+func Idempotency(db *gorm.DB, requestTimeout time.Duration) echo.MiddlewareFunc {
+	lockTimeout := requestTimeout
+	if lockTimeout <= 0 {
+		lockTimeout = defaultIdempotencyLockTimeout
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			key := c.Request().Header.Get(IdempotencyKeyHeader)
+			if key == "" {
+				return next(c)
+			}
+			if len(key) > maxIdempotencyKeyLen {
+				return utils.HandleError(c, utils.NewBadRequestError("Idempotency-Key is too long"))
+			}
+
+			user := auth.CurrentUser(c)
+			if user == nil {
+				return utils.HandleError(c, utils.NewUnauthorizedError("Missing token"))
+			}
+
+			// Read the body so it can be fingerprinted, then hand it back to the handler
+			body, err := io.ReadAll(c.Request().Body)
+			if err != nil {
+				return utils.HandleError(c, utils.NewBadRequestError("Invalid request body"))
+			}
+			c.Request().Body = io.NopCloser(bytes.NewReader(body))
+
+			now := time.Now()
+			req := c.Request()
+			hash := sha256.New()
+			hash.Write([]byte(req.Method + " " + req.URL.Path + "\n"))
+			hash.Write(body)
+
+			record := models.IdempotencyKey{
+				UserID:      user.ID,
+				Key:         key,
+				Method:      req.Method,
+				Path:        req.URL.Path,
+				RequestHash: hex.EncodeToString(hash.Sum(nil)),
+				CreatedAt:   now,
+			}
+
+			// Keys are only remembered for a limited time. They are kept without
+			// the request's context, so a request that timed out still completes
+			// or frees its key.
+			err = db.Where("user_id = ? AND idempotency_key = ? AND (created_at < ? OR (completed_at IS NULL AND created_at < ?))",
+				record.UserID, key, now.Add(-idempotencyKeyTTL), now.Add(-lockTimeout)).
+				Delete(&models.IdempotencyKey{}).Error
+			if err != nil {
+				return utils.HandleError(c, utils.NewInternalError("Failed to check idempotency key"))
+			}
+
+			result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&record)
+			if result.Error != nil {
+				return utils.HandleError(c, utils.NewInternalError("Failed to store idempotency key"))
+			}
+			if result.RowsAffected == 0 {
+				return replayIdempotent(c, db, record)
+			}
+
+			// The key is freed for another attempt unless the request went
+			// through, also when the handler panics
+			release := true
+			defer func() {
+				if !release {
+					return
+				}
+				if err := db.Delete(&record).Error; err != nil {
+					c.Logger().Errorf("freeing idempotency key %q of user %d: %v", record.Key, record.UserID, err)
+				}
+			}()
+
+			recorder := &responseRecorder{ResponseWriter: c.Response().Writer}
+			c.Response().Writer = recorder
+
+			err = next(c)
+
+			// Only keep responses that the client should not retry differently;
+			// server errors and unhandled errors free the key for another attempt
+			status := c.Response().Status
+			if err != nil || !c.Response().Committed || status >= http.StatusInternalServerError {
+				return err
+			}
+			release = false
+
+			// Should this fail, retries are refused as in progress until the key
+			// times out, rather than repeating a request that went through
+			completedAt := time.Now()
+			err = db.Model(&record).Updates(models.IdempotencyKey{
+				StatusCode:   status,
+				ContentType:  c.Response().Header().Get(echo.HeaderContentType),
+				ResponseBody: recorder.body.String(),
+				CompletedAt:  &completedAt,
+			}).Error
+			if err != nil {
+				c.Logger().Errorf("storing the response for idempotency key %q of user %d: %v", record.Key, record.UserID, err)
+			}
+
+			return nil
+		}
+	}
+}
+
+// PruneIdempotencyKeys deletes the keys that were forgotten by now and
+// returns how many there were.
+func PruneIdempotencyKeys(db *gorm.DB, now time.Time) (int64, error) {
+	result := db.Where("created_at < ?", now.Add(-idempotencyKeyTTL)).Delete(&models.IdempotencyKey{})
+	return result.RowsAffected, result.Error
+}
+
+func replayIdempotent(c echo.Context, db *gorm.DB, record models.IdempotencyKey) error {
+	var stored models.IdempotencyKey
+	if err := db.Where("user_id = ? AND idempotency_key = ?", record.UserID, record.Key).First(&stored).Error; err != nil {
+		return utils.HandleError(c, utils.NewInternalError("Failed to check idempotency key"))
+	}
+
+	if stored.RequestHash != record.RequestHash {
+		return utils.HandleError(c, &utils.APIError{
+			Code:    http.StatusUnprocessableEntity,
+			Message: "Idempotency-Key was already used for a different request",
+			Detail:  "Idempotency key conflict",
+		})
+	}
+	if stored.CompletedAt == nil {
+		return utils.HandleError(c, &utils.APIError{
+			Code:    http.StatusConflict,
+			Message: "A request with this Idempotency-Key is still being processed",
+			Detail:  "Idempotency key conflict",
+		})
+	}
+
+	c.Response().Header().Set("Idempotent-Replayed", "true")
+	return c.Blob(stored.StatusCode, stored.ContentType, []byte(stored.ResponseBody))
+}
@@ -0,0 +1,47 @@
+package middlewares
+
+import (
+	"finalp2/auth"
+	"finalp2/models"
+	"finalp2/utils"
+
+	"github.com/labstack/echo/v4"
+)
+
+// RequireStaff only lets library staff and admins through. It must run after
+// the JWT middleware.
+func RequireStaff(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		user := auth.CurrentUser(c)
+		if user == nil {
+			return utils.HandleError(c, utils.NewUnauthorizedError("Missing token"))
+		}
+		if !user.IsStaff() {
+			return utils.HandleError(c, utils.NewForbiddenError("Staff access required"))
+		}
+
+		return next(c)
+	}
+}
+
+// RequireAdmin only lets admins through, and only when they logged in with
+// two-factor authentication. It must run after the JWT middleware.
+func RequireAdmin(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		user := auth.CurrentUser(c)
+		if user == nil {
+			return utils.HandleError(c, utils.NewUnauthorizedError("Missing token"))
+		}
+		if user.Role != models.RoleAdmin {
+			return utils.HandleError(c, utils.NewForbiddenError("Admin access required"))
+		}
+		if user.TOTPEnabledAt == nil {
+			return utils.HandleError(c, utils.NewForbiddenError("Admins must enable two-factor authentication"))
+		}
+		if !auth.CurrentClaims(c).TwoFactor() {
+			return utils.HandleError(c, utils.NewForbiddenError("Please log in again with two-factor authentication"))
+		}
+
+		return next(c)
+	}
+}
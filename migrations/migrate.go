@@ -0,0 +1,288 @@
+// Package migrations versions the database schema. Each change is a pair of
+// SQL files, <version>_<name>.up.sql and <version>_<name>.down.sql, embedded
+// in the binary and applied in version order. Every supported database has
+// its own directory in sql/ with the same migrations written in its dialect.
+package migrations
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+//go:embed sql
+var files embed.FS
+
+// lockID is the Postgres advisory lock held while migrating, so instances
+// started together don't apply the same migration twice.
+const lockID = 7243901
+
+var ErrNoMigrations = errors.New("no migrations to roll back")
+
+// Migration is one versioned schema change.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// SchemaMigration records an applied migration in schema_migrations.
+type SchemaMigration struct {
+	Version   int64     `gorm:"primaryKey;column:version;autoIncrement:false"`
+	Name      string    `gorm:"column:name"`
+	AppliedAt time.Time `gorm:"column:applied_at"`
+}
+
+func (SchemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// Status is a migration and when it was applied, if it was.
+type Status struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// Migrator applies and rolls back the embedded migrations.
+type Migrator struct {
+	db         *gorm.DB
+	migrations []Migration
+}
+
+// New loads the migrations written for the database's dialect.
+func New(db *gorm.DB) (*Migrator, error) {
+	migrations, err := load(files, db.Dialector.Name())
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// Up applies every pending migration and returns the ones it applied. They
+// are applied in one transaction, so when one fails none of them are.
+func (m *Migrator) Up() ([]Migration, error) {
+	var applied []Migration
+	err := m.locked(func(db *gorm.DB) error {
+		done, err := appliedVersions(db)
+		if err != nil {
+			return err
+		}
+		for _, migration := range m.migrations {
+			if _, ok := done[migration.Version]; ok {
+				continue
+			}
+			err := db.Exec(migration.Up).Error
+			if err == nil {
+				err = db.Create(&SchemaMigration{
+					Version:   migration.Version,
+					Name:      migration.Name,
+					AppliedAt: time.Now(),
+				}).Error
+			}
+			if err != nil {
+				return fmt.Errorf("applying %d_%s: %w", migration.Version, migration.Name, err)
+			}
+			applied = append(applied, migration)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return applied, nil
+}
+
+// Down rolls back the last steps applied migrations, newest first, in one
+// transaction like Up.
+func (m *Migrator) Down(steps int) ([]Migration, error) {
+	var rolledBack []Migration
+	err := m.locked(func(db *gorm.DB) error {
+		done, err := appliedVersions(db)
+		if err != nil {
+			return err
+		}
+		for i := len(m.migrations) - 1; i >= 0 && len(rolledBack) < steps; i-- {
+			migration := m.migrations[i]
+			if _, ok := done[migration.Version]; !ok {
+				continue
+			}
+			err := db.Exec(migration.Down).Error
+			if err == nil {
+				err = db.Delete(&SchemaMigration{}, migration.Version).Error
+			}
+			if err != nil {
+				return fmt.Errorf("rolling back %d_%s: %w", migration.Version, migration.Name, err)
+			}
+			rolledBack = append(rolledBack, migration)
+		}
+		if len(rolledBack) == 0 {
+			return ErrNoMigrations
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rolledBack, nil
+}
+
+// Status lists every migration with the time it was applied.
+func (m *Migrator) Status() ([]Status, error) {
+	if err := m.createTable(m.db); err != nil {
+		return nil, err
+	}
+	done, err := appliedVersions(m.db)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, len(m.migrations))
+	for i, migration := range m.migrations {
+		statuses[i].Migration = migration
+		if record, ok := done[migration.Version]; ok {
+			appliedAt := record.AppliedAt
+			statuses[i].AppliedAt = &appliedAt
+		}
+	}
+	return statuses, nil
+}
+
+// Pending reports how many migrations have not been applied yet. Unlike
+// Status it only reads, so health checks can call it often; without a
+// schema_migrations table every migration is pending.
+func (m *Migrator) Pending() (int, error) {
+	var versions []int64
+	if err := m.db.Model(&SchemaMigration{}).Pluck("version", &versions).Error; err != nil {
+		// The table may well exist when the query was cut short
+		if m.db.Statement.Context.Err() != nil || m.db.Migrator().HasTable(&SchemaMigration{}) {
+			return 0, err
+		}
+		return len(m.migrations), nil
+	}
+
+	applied := make(map[int64]bool, len(versions))
+	for _, version := range versions {
+		applied[version] = true
+	}
+	pending := 0
+	for _, migration := range m.migrations {
+		if !applied[migration.Version] {
+			pending++
+		}
+	}
+	return pending, nil
+}
+
+// locked runs fn in a transaction holding the advisory lock. The lock is
+// released with the transaction rather than the connection, so it also works
+// through a transaction pooler such as Supabase's on port 6543, which may
+// hand every transaction of a session to another server connection.
+func (m *Migrator) locked(fn func(db *gorm.DB) error) error {
+	return m.db.Transaction(func(tx *gorm.DB) error {
+		if tx.Dialector.Name() == "postgres" {
+			if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", lockID).Error; err != nil {
+				return fmt.Errorf("taking migration lock: %w", err)
+			}
+		}
+
+		if err := m.createTable(tx); err != nil {
+			return err
+		}
+		return fn(tx)
+	})
+}
+
+func (m *Migrator) createTable(db *gorm.DB) error {
+	return db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+    version BIGINT PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    applied_at TIMESTAMP NOT NULL
+)`).Error
+}
+
+func appliedVersions(db *gorm.DB) (map[int64]SchemaMigration, error) {
+	var records []SchemaMigration
+	if err := db.Order("version").Find(&records).Error; err != nil {
+		return nil, err
+	}
+	done := make(map[int64]SchemaMigration, len(records))
+	for _, record := range records {
+		done[record.Version] = record
+	}
+	return done, nil
+}
+
+// load reads the migrations of the dialect from fsys and checks every version
+// has both an up and a down file.
+func load(fsys fs.FS, dialect string) ([]Migration, error) {
+	names, err := fs.Glob(fsys, path.Join("sql", dialect, "*.sql"))
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no migrations for %s databases", dialect)
+	}
+
+	byVersion := map[int64]*Migration{}
+	for _, name := range names {
+		base := path.Base(name)
+		stem, direction, ok := cutDirection(base)
+		if !ok {
+			return nil, fmt.Errorf("migration %s must end in .up.sql or .down.sql", base)
+		}
+		rawVersion, migrationName, ok := strings.Cut(stem, "_")
+		version, err := strconv.ParseInt(rawVersion, 10, 64)
+		if !ok || err != nil || version <= 0 {
+			return nil, fmt.Errorf("migration %s must be named <version>_<name>", base)
+		}
+
+		body, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+
+		migration, exists := byVersion[version]
+		if !exists {
+			migration = &Migration{Version: version, Name: migrationName}
+			byVersion[version] = migration
+		} else if migration.Name != migrationName {
+			return nil, fmt.Errorf("migration version %d is used by %s and %s", version, migration.Name, migrationName)
+		}
+		if direction == "up" {
+			migration.Up = string(body)
+		} else {
+			migration.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s needs both an up and a down file", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+func cutDirection(name string) (stem, direction string, ok bool) {
+	if stem, ok := strings.CutSuffix(name, ".up.sql"); ok {
+		return stem, "up", true
+	}
+	if stem, ok := strings.CutSuffix(name, ".down.sql"); ok {
+		return stem, "down", true
+	}
+	return "", "", false
+}
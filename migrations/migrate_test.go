@@ -0,0 +1,212 @@
+package migrations
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"finalp2/config"
+	"finalp2/models"
+)
+
+// legacyData is a database built by hand from the old query.sql, before the
+// migrations existed.
+const legacyData = `
+INSERT INTO Users (email, password_hash, first_name, deposit, jwt_token)
+VALUES ('user1@example.com', 'hash', 'John', 50000, 'token');
+INSERT INTO Authors (first_name, last_name) VALUES ('George', 'Orwell');
+INSERT INTO Categories (name) VALUES ('Science Fiction');
+INSERT INTO Books (author_id, category_id, title, isbn, stock, price, reading_days)
+VALUES (1, 1, '1984', '9780451524935', 10, 20000, 14);
+INSERT INTO Rentals (user_id, rental_date, rental_status, total_price)
+VALUES (1, '2024-08-01 00:00:00', 'completed', 20000),
+    (1, '2024-08-03 00:00:00', 'Returned', 20000),
+    (1, '2024-08-05 00:00:00', 'paid', 20000),
+    (1, '2024-08-07 00:00:00', 'created', 20000);
+INSERT INTO Rental_Details (rental_id, book_id, returned) VALUES (1, 1, TRUE);
+INSERT INTO Payments (rental_id, payment_date, payment_amount) VALUES (1, '2024-08-02', 20000);
+`
+
+func openSQLite(t *testing.T) *Migrator {
+	t.Helper()
+	db, err := config.InitDB(config.DatabaseConfig{Driver: "sqlite", Path: ":memory:"})
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	migrator, err := New(db)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return migrator
+}
+
+func TestDialectsHaveTheSameMigrations(t *testing.T) {
+	postgres, err := load(files, "postgres")
+	if err != nil {
+		t.Fatalf("loading postgres migrations: %v", err)
+	}
+	sqlite, err := load(files, "sqlite")
+	if err != nil {
+		t.Fatalf("loading sqlite migrations: %v", err)
+	}
+
+	if len(postgres) != len(sqlite) {
+		t.Fatalf("postgres has %d migrations, sqlite %d", len(postgres), len(sqlite))
+	}
+	for i := range postgres {
+		if postgres[i].Version != sqlite[i].Version || postgres[i].Name != sqlite[i].Name {
+			t.Errorf("migration %d is %d_%s on postgres but %d_%s on sqlite", i,
+				postgres[i].Version, postgres[i].Name, sqlite[i].Version, sqlite[i].Name)
+		}
+	}
+}
+
+func TestLoadUnknownDialect(t *testing.T) {
+	if _, err := load(files, "mysql"); err == nil {
+		t.Fatal("loading migrations for mysql succeeded")
+	}
+}
+
+func TestUpAndDownOnSQLite(t *testing.T) {
+	migrator := openSQLite(t)
+	db := migrator.db
+
+	applied, err := migrator.Up()
+	if err != nil {
+		t.Fatalf("Up: %v", err)
+	}
+	if len(applied) != len(migrator.migrations) {
+		t.Fatalf("Up applied %d migrations, want %d", len(applied), len(migrator.migrations))
+	}
+	if pending, err := migrator.Pending(); err != nil || pending != 0 {
+		t.Fatalf("Pending = %d, %v after Up", pending, err)
+	}
+	if applied, err := migrator.Up(); err != nil || len(applied) != 0 {
+		t.Fatalf("second Up applied %d migrations, err %v", len(applied), err)
+	}
+	if err := db.Exec("SELECT count(*) FROM rental_details").Error; err != nil {
+		t.Fatalf("querying rental_details after Up: %v", err)
+	}
+
+	if _, err := migrator.Down(len(migrator.migrations)); err != nil {
+		t.Fatalf("Down: %v", err)
+	}
+	if err := db.Exec("SELECT count(*) FROM users").Error; err == nil {
+		t.Fatal("users table still exists after Down")
+	}
+	if _, err := migrator.Down(1); !errors.Is(err, ErrNoMigrations) {
+		t.Fatalf("Down on an empty database: err = %v, want ErrNoMigrations", err)
+	}
+}
+
+func TestUpAdoptsBaselineDatabase(t *testing.T) {
+	migrator := openSQLite(t)
+	db := migrator.db
+	if err := db.Exec(migrator.migrations[0].Up).Error; err != nil {
+		t.Fatalf("creating the baseline schema: %v", err)
+	}
+	if err := db.Exec(legacyData).Error; err != nil {
+		t.Fatalf("inserting legacy data: %v", err)
+	}
+
+	if _, err := migrator.Up(); err != nil {
+		t.Fatalf("Up: %v", err)
+	}
+
+	var user models.User
+	if err := db.First(&user).Error; err != nil {
+		t.Fatalf("loading the legacy user: %v", err)
+	}
+	if user.Role != models.RoleCustomer || user.EmailVerifiedAt == nil {
+		t.Fatalf("legacy user = %+v, want a verified customer", user)
+	}
+
+	var detail models.RentalDetail
+	if err := db.First(&detail).Error; err != nil {
+		t.Fatalf("loading the legacy rental detail: %v", err)
+	}
+	if want := time.Date(2024, 8, 15, 0, 0, 0, 0, time.UTC); detail.DueDate == nil || !detail.DueDate.Equal(want) {
+		t.Fatalf("due date = %v, want %v", detail.DueDate, want)
+	}
+	if err := db.Exec("SELECT invoice_id FROM payments").Error; err != nil {
+		t.Fatalf("payments not migrated: %v", err)
+	}
+
+	var rentals []models.Rental
+	if err := db.Order("rental_id").Find(&rentals).Error; err != nil {
+		t.Fatalf("loading the legacy rentals: %v", err)
+	}
+	want := []models.RentalStatus{models.RentalReturned, models.RentalReturned, models.RentalActive, models.RentalPendingPayment}
+	for i, rental := range rentals {
+		if rental.RentalStatus != want[i] {
+			t.Errorf("rental %d has status %s, want %s", rental.ID, rental.RentalStatus, want[i])
+		}
+	}
+	var history int64
+	db.Model(&models.RentalStatusHistory{}).Count(&history)
+	if history != int64(len(want)) {
+		t.Errorf("%d status history entries, want %d", history, len(want))
+	}
+
+	if err := db.Exec("UPDATE rentals SET rental_status = 'completed'").Error; err == nil {
+		t.Error("setting a legacy status succeeded after the migration")
+	}
+}
+
+func TestPendingDoesNotCreateTheTable(t *testing.T) {
+	migrator := openSQLite(t)
+
+	pending, err := migrator.Pending()
+	if err != nil || pending != len(migrator.migrations) {
+		t.Fatalf("Pending = %d, %v on an empty database, want %d", pending, err, len(migrator.migrations))
+	}
+	if err := migrator.db.Exec("SELECT count(*) FROM schema_migrations").Error; err == nil {
+		t.Fatal("Pending created schema_migrations")
+	}
+}
+
+func TestUpAppliesNothingWhenAMigrationFails(t *testing.T) {
+	migrator := openSQLite(t)
+	migrator.migrations = []Migration{
+		{Version: 1, Name: "create_a", Up: "CREATE TABLE a (id INT)", Down: "DROP TABLE a"},
+		{Version: 2, Name: "broken", Up: "CREATE TABLE", Down: ""},
+	}
+
+	applied, err := migrator.Up()
+	if err == nil || applied != nil {
+		t.Fatalf("Up = %v, %v, want the error of the broken migration", applied, err)
+	}
+	if migrator.db.Migrator().HasTable("a") {
+		t.Fatal("the migration before the broken one was kept")
+	}
+	if pending, err := migrator.Pending(); err != nil || pending != 2 {
+		t.Fatalf("Pending = %d, %v, want 2", pending, err)
+	}
+}
+
+func TestUpLowercasesEmails(t *testing.T) {
+	migrator := openSQLite(t)
+	all := migrator.migrations
+	migrator.migrations = all[:6]
+	if _, err := migrator.Up(); err != nil {
+		t.Fatalf("Up to 6: %v", err)
+	}
+	db := migrator.db
+	err := db.Exec("INSERT INTO Users (email, password_hash, first_name) VALUES (' Mixed@Example.com', 'hash', 'Mia')").Error
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	migrator.migrations = all
+	if _, err := migrator.Up(); err != nil {
+		t.Fatalf("Up: %v", err)
+	}
+	var user models.User
+	if err := db.Where("first_name = ?", "Mia").First(&user).Error; err != nil || user.Email != "mixed@example.com" {
+		t.Fatalf("user = %+v, %v, want the email lowercased", user, err)
+	}
+	err = db.Exec("INSERT INTO Users (email, password_hash, first_name) VALUES ('MIXED@example.com', 'hash', 'Max')").Error
+	if err == nil {
+		t.Fatal("inserted an email that only differs in case")
+	}
+}
@@ -0,0 +1,8 @@
+DROP TABLE IF EXISTS Payments;
+DROP TABLE IF EXISTS Rental_Details;
+DROP TABLE IF EXISTS Carts;
+DROP TABLE IF EXISTS Rentals;
+DROP TABLE IF EXISTS Books;
+DROP TABLE IF EXISTS Categories;
+DROP TABLE IF EXISTS Authors;
+DROP TABLE IF EXISTS Users;
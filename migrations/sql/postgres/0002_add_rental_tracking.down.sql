@@ -0,0 +1,13 @@
+ALTER TABLE Payments
+    DROP COLUMN invoice_url,
+    DROP COLUMN invoice_id;
+
+DROP INDEX IF EXISTS idx_rental_details_rental_id;
+ALTER TABLE Rental_Details
+    DROP COLUMN copy_id,
+    DROP COLUMN returned_at,
+    DROP COLUMN due_date;
+
+DROP TABLE IF EXISTS Book_Copies;
+DROP INDEX IF EXISTS idx_rentals_user_id;
+DROP TABLE IF EXISTS Rental_Status_Histories;
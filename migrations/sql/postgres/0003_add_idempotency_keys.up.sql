@@ -0,0 +1,18 @@
+-- Responses stored by Idempotency-Key, so retried requests are not applied
+-- twice.
+
+-- Table: Idempotency_Keys
+CREATE TABLE Idempotency_Keys (
+    idempotency_key_id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES Users(user_id) ON DELETE CASCADE,
+    idempotency_key VARCHAR(255) NOT NULL,
+    method VARCHAR(10) NOT NULL,
+    path TEXT NOT NULL,
+    request_hash CHAR(64) NOT NULL,
+    status_code INT NOT NULL DEFAULT 0,
+    content_type VARCHAR(255),
+    response_body TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    completed_at TIMESTAMP,
+    CONSTRAINT idx_idempotency_user_key UNIQUE (user_id, idempotency_key)
+);
@@ -0,0 +1,91 @@
+-- Roles, email verification, two-factor login and account deletion for
+-- users, and the tables behind sessions, emailed tokens, OpenID Connect
+-- logins, API keys and login throttling. Sessions replace the token that was
+-- stored on the user.
+
+ALTER TABLE Users
+    ADD COLUMN role VARCHAR(20) NOT NULL DEFAULT 'customer' CHECK (role IN ('customer', 'staff', 'admin')),
+    ADD COLUMN email_verified_at TIMESTAMP,
+    ADD COLUMN totp_secret VARCHAR(64),
+    ADD COLUMN totp_enabled_at TIMESTAMP,
+    ADD COLUMN totp_last_step BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN deleted_at TIMESTAMP,
+    DROP COLUMN jwt_token;
+
+-- Accounts from before email verification keep logging in when it is required
+UPDATE Users SET email_verified_at = NOW();
+
+-- Table: User_Identities
+CREATE TABLE User_Identities (
+    user_identity_id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES Users(user_id) ON DELETE CASCADE,
+    provider VARCHAR(64) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    email VARCHAR(255),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    CONSTRAINT idx_user_identity_provider_subject UNIQUE (provider, subject)
+);
+
+-- Table: Recovery_Codes
+CREATE TABLE Recovery_Codes (
+    recovery_code_id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES Users(user_id) ON DELETE CASCADE,
+    code_hash CHAR(64) NOT NULL,
+    used_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- Table: API_Keys
+CREATE TABLE API_Keys (
+    api_key_id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES Users(user_id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    prefix VARCHAR(16) NOT NULL,
+    key_hash CHAR(64) NOT NULL UNIQUE,
+    scopes TEXT NOT NULL,
+    expires_at TIMESTAMP,
+    last_used_at TIMESTAMP,
+    revoked_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_api_keys_user_id ON API_Keys(user_id);
+
+-- Table: User_Tokens
+CREATE TABLE User_Tokens (
+    token_id VARCHAR(64) PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES Users(user_id) ON DELETE CASCADE,
+    purpose VARCHAR(32) NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    used_at TIMESTAMP
+);
+
+CREATE INDEX idx_user_tokens_user_purpose ON User_Tokens(user_id, purpose);
+
+-- Table: Sessions
+CREATE TABLE Sessions (
+    session_id VARCHAR(64) PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES Users(user_id) ON DELETE CASCADE,
+    two_factor BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    revoked_at TIMESTAMP
+);
+
+-- Table: Refresh_Tokens
+CREATE TABLE Refresh_Tokens (
+    refresh_token_id SERIAL PRIMARY KEY,
+    session_id VARCHAR(64) NOT NULL REFERENCES Sessions(session_id) ON DELETE CASCADE,
+    token_hash CHAR(64) NOT NULL UNIQUE,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    used_at TIMESTAMP
+);
+
+-- Table: Login_Attempts
+CREATE TABLE Login_Attempts (
+    attempt_key VARCHAR(320) PRIMARY KEY,
+    failures INT NOT NULL DEFAULT 0,
+    last_failure_at TIMESTAMP NOT NULL,
+    blocked_until TIMESTAMP
+);
@@ -0,0 +1,3 @@
+-- The legacy statuses are not restored, as rentals made since can't be told
+-- apart from the migrated ones
+ALTER TABLE Rentals DROP CONSTRAINT IF EXISTS rentals_rental_status_check;
@@ -0,0 +1,28 @@
+-- Rentals from before the status state machine use the old statuses:
+-- unpaid orders are "created", paid ones "paid" and finished ones "completed"
+-- or "Returned". They move to the statuses that mean the same now, so they
+-- can still be paid and returned, and the change is kept in their history.
+
+INSERT INTO Rental_Status_Histories (rental_id, from_status, to_status, note)
+SELECT rental_id, rental_status,
+    CASE rental_status
+        WHEN 'created' THEN 'pending_payment'
+        WHEN 'paid' THEN 'active'
+        ELSE 'returned'
+    END,
+    'migrated from the legacy status'
+FROM Rentals
+WHERE rental_status IN ('created', 'paid', 'completed', 'Returned');
+
+UPDATE Rentals
+SET rental_status = CASE rental_status
+        WHEN 'created' THEN 'pending_payment'
+        WHEN 'paid' THEN 'active'
+        ELSE 'returned'
+    END
+WHERE rental_status IN ('created', 'paid', 'completed', 'Returned');
+
+ALTER TABLE Rentals ADD CONSTRAINT rentals_rental_status_check CHECK (rental_status IN (
+    'created', 'pending_payment', 'paid', 'active', 'partially_returned',
+    'returned', 'cancelled', 'expired', 'overdue'
+));
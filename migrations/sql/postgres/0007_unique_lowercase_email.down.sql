@@ -0,0 +1,2 @@
+-- The original case of the addresses is not restored
+DROP INDEX IF EXISTS idx_users_email_lower;
@@ -0,0 +1,74 @@
+-- Initial schema, the SQLite version of postgres/0001_initial_schema.up.sql.
+
+-- Table: Users
+CREATE TABLE IF NOT EXISTS Users (
+    user_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    email VARCHAR(255) NOT NULL UNIQUE,
+    password_hash VARCHAR(255) NOT NULL,
+    first_name VARCHAR(255),
+    last_name VARCHAR(255),
+    birth_date DATE,
+    address TEXT,
+    contact_no VARCHAR(20),
+    deposit INT DEFAULT 0,
+    jwt_token TEXT
+);
+
+-- Table: Authors
+CREATE TABLE IF NOT EXISTS Authors (
+    author_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    first_name VARCHAR(255),
+    last_name VARCHAR(255),
+    nationality VARCHAR(255),
+    birth_date DATE
+);
+
+-- Table: Categories
+CREATE TABLE IF NOT EXISTS Categories (
+    category_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name VARCHAR(255) NOT NULL UNIQUE
+);
+
+-- Table: Books
+CREATE TABLE IF NOT EXISTS Books (
+    book_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    author_id INT REFERENCES Authors(author_id) ON DELETE SET NULL,
+    category_id INT REFERENCES Categories(category_id) ON DELETE SET NULL,
+    title VARCHAR(255) NOT NULL,
+    isbn VARCHAR(13) UNIQUE,
+    stock INT DEFAULT 0,
+    price INT NOT NULL,
+    reading_days INT DEFAULT 0
+);
+
+-- Table: Rentals
+CREATE TABLE IF NOT EXISTS Rentals (
+    rental_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INT REFERENCES Users(user_id) ON DELETE CASCADE,
+    rental_date TIMESTAMP,
+    rental_status VARCHAR(50) DEFAULT 'created',
+    total_price INT DEFAULT 0
+);
+
+-- Table: Cart
+CREATE TABLE IF NOT EXISTS Carts (
+    cart_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INT REFERENCES Users(user_id) ON DELETE CASCADE,
+    book_id INT REFERENCES Books(book_id) ON DELETE CASCADE
+);
+
+-- Table: Rental_Details
+CREATE TABLE IF NOT EXISTS Rental_Details (
+    rental_detail_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    rental_id INT REFERENCES Rentals(rental_id) ON DELETE CASCADE,
+    book_id INT REFERENCES Books(book_id) ON DELETE CASCADE,
+    returned BOOLEAN DEFAULT FALSE
+);
+
+-- Table: Payments
+CREATE TABLE IF NOT EXISTS Payments (
+    payment_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    rental_id INT REFERENCES Rentals(rental_id) ON DELETE CASCADE,
+    payment_date DATE,
+    payment_amount DECIMAL(10, 2) NOT NULL
+);
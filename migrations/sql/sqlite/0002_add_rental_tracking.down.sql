@@ -0,0 +1,20 @@
+ALTER TABLE Payments DROP COLUMN invoice_url;
+ALTER TABLE Payments DROP COLUMN invoice_id;
+
+-- SQLite cannot drop a column with a foreign key, so Rental_Details is
+-- rebuilt without the new columns
+DROP INDEX IF EXISTS idx_rental_details_rental_id;
+CREATE TABLE Rental_Details_Rebuilt (
+    rental_detail_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    rental_id INT REFERENCES Rentals(rental_id) ON DELETE CASCADE,
+    book_id INT REFERENCES Books(book_id) ON DELETE CASCADE,
+    returned BOOLEAN DEFAULT FALSE
+);
+INSERT INTO Rental_Details_Rebuilt (rental_detail_id, rental_id, book_id, returned)
+SELECT rental_detail_id, rental_id, book_id, returned FROM Rental_Details;
+DROP TABLE Rental_Details;
+ALTER TABLE Rental_Details_Rebuilt RENAME TO Rental_Details;
+
+DROP TABLE IF EXISTS Book_Copies;
+DROP INDEX IF EXISTS idx_rentals_user_id;
+DROP TABLE IF EXISTS Rental_Status_Histories;
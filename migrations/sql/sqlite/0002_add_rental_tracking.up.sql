@@ -0,0 +1,43 @@
+-- Rental status history, due dates and returns per item, physical book
+-- copies, and the invoice a payment was made with.
+
+-- Table: Rental_Status_Histories
+CREATE TABLE Rental_Status_Histories (
+    history_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    rental_id INT REFERENCES Rentals(rental_id) ON DELETE CASCADE,
+    from_status VARCHAR(50),
+    to_status VARCHAR(50) NOT NULL,
+    changed_by INT REFERENCES Users(user_id) ON DELETE SET NULL,
+    note TEXT,
+    changed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_rentals_user_id ON Rentals(user_id, rental_id);
+
+-- Table: Book_Copies
+CREATE TABLE Book_Copies (
+    copy_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    book_id INT NOT NULL REFERENCES Books(book_id) ON DELETE CASCADE,
+    barcode VARCHAR(64) NOT NULL UNIQUE,
+    status VARCHAR(20) NOT NULL DEFAULT 'available' CHECK (status IN ('available', 'rented'))
+);
+
+CREATE INDEX idx_book_copies_book_id ON Book_Copies(book_id, status);
+
+ALTER TABLE Rental_Details ADD COLUMN due_date TIMESTAMP;
+ALTER TABLE Rental_Details ADD COLUMN returned_at TIMESTAMP;
+ALTER TABLE Rental_Details ADD COLUMN copy_id INT REFERENCES Book_Copies(copy_id) ON DELETE SET NULL;
+
+CREATE INDEX idx_rental_details_rental_id ON Rental_Details(rental_id);
+
+-- Items rented before due dates were kept are due after the book's reading
+-- period, counted from the rental date
+UPDATE Rental_Details
+SET due_date = datetime(Rentals.rental_date, '+' || COALESCE(Books.reading_days, 0) || ' days')
+FROM Rentals, Books
+WHERE Rentals.rental_id = Rental_Details.rental_id
+    AND Books.book_id = Rental_Details.book_id
+    AND Rentals.rental_date IS NOT NULL;
+
+ALTER TABLE Payments ADD COLUMN invoice_id VARCHAR(255);
+ALTER TABLE Payments ADD COLUMN invoice_url TEXT;
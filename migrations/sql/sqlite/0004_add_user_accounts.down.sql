@@ -0,0 +1,15 @@
+DROP TABLE IF EXISTS Login_Attempts;
+DROP TABLE IF EXISTS Refresh_Tokens;
+DROP TABLE IF EXISTS Sessions;
+DROP TABLE IF EXISTS User_Tokens;
+DROP TABLE IF EXISTS API_Keys;
+DROP TABLE IF EXISTS Recovery_Codes;
+DROP TABLE IF EXISTS User_Identities;
+
+ALTER TABLE Users ADD COLUMN jwt_token TEXT;
+ALTER TABLE Users DROP COLUMN deleted_at;
+ALTER TABLE Users DROP COLUMN totp_last_step;
+ALTER TABLE Users DROP COLUMN totp_enabled_at;
+ALTER TABLE Users DROP COLUMN totp_secret;
+ALTER TABLE Users DROP COLUMN email_verified_at;
+ALTER TABLE Users DROP COLUMN role;
@@ -0,0 +1,4 @@
+-- The legacy statuses are not restored, as rentals made since can't be told
+-- apart from the migrated ones
+DROP TRIGGER IF EXISTS rentals_rental_status_check_update;
+DROP TRIGGER IF EXISTS rentals_rental_status_check_insert;
@@ -0,0 +1 @@
+ALTER TABLE Sessions DROP COLUMN auth_method;
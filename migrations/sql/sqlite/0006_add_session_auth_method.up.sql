@@ -0,0 +1,5 @@
+-- How each session was signed in to, 'pwd' for a password or 'fed' for a
+-- login provider, so users without a password can confirm changes with a
+-- recent provider login. Older sessions are taken to be password logins.
+
+ALTER TABLE Sessions ADD COLUMN auth_method VARCHAR(10) NOT NULL DEFAULT 'pwd';
@@ -0,0 +1,7 @@
+-- Emails are stored trimmed and in lower case, and addresses that only differ
+-- in case belong to the same account. When two existing accounts only differ
+-- in case this fails on the unique email constraint; merge them by hand first.
+
+UPDATE Users SET email = LOWER(TRIM(email)) WHERE email <> LOWER(TRIM(email));
+
+CREATE UNIQUE INDEX idx_users_email_lower ON Users (LOWER(email));
@@ -1,41 +1,162 @@
 package models
 
-import "time"
-
+import (
+	"strings"
+	"time"
+)
 
 type User struct {
-	ID      		uint   `gorm:"primaryKey;column:user_id"`  
-	Email           string `gorm:"column:email" json:"email"`
-	Password    	string `gorm:"column:password_hash" json:"password"`
-	FirstName    	string `gorm:"column:first_name" json:"first_name"`
-	LastName    	string `gorm:"column:last_name" json:"last_name"`
-	Birth_date		string `gorm:"column:birth_date" json:"birth_date"`
-	Address			string `gorm:"column:address" json:"address"`
-	Contact			string `gorm:"column:contact_no" json:"contact_no"`
-	Deposit			uint   `gorm:"column:deposit" json:"deposit"`
-	JwtToken        string `gorm:"column:jwt_token"`
+	ID         uint   `gorm:"primaryKey;column:user_id"`
+	Email      string `gorm:"column:email" json:"email"`
+	Password   string `gorm:"column:password_hash" json:"password"`
+	FirstName  string `gorm:"column:first_name" json:"first_name"`
+	LastName   string `gorm:"column:last_name" json:"last_name"`
+	Birth_date string `gorm:"column:birth_date" json:"birth_date"`
+	Address    string `gorm:"column:address" json:"address"`
+	Contact    string `gorm:"column:contact_no" json:"contact_no"`
+	Deposit    uint   `gorm:"column:deposit" json:"deposit"`
+	Role       string `gorm:"column:role;default:customer" json:"-"`
 
+	EmailVerifiedAt *time.Time `gorm:"column:email_verified_at" json:"-"`
+	// TOTPSecret is set when enrolment starts; two-factor login is only
+	// required once TOTPEnabledAt is set. TOTPLastStep stops a code from
+	// being used twice.
+	TOTPSecret    string     `gorm:"column:totp_secret" json:"-"`
+	TOTPEnabledAt *time.Time `gorm:"column:totp_enabled_at" json:"-"`
+	TOTPLastStep  int64      `gorm:"column:totp_last_step" json:"-"`
+	// DeletedAt is set when the user deletes their account. The row is kept,
+	// with personal data removed, so rentals and payments still reference it.
+	DeletedAt *time.Time `gorm:"column:deleted_at" json:"-"`
+}
+
+const (
+	RoleCustomer = "customer"
+	RoleStaff    = "staff"
+	RoleAdmin    = "admin"
+)
+
+// IsStaff reports whether the user works at the library.
+func (u User) IsStaff() bool {
+	return u.Role == RoleStaff || u.Role == RoleAdmin
+}
+
+// UserIdentity links a user to their account at an external OpenID Connect
+// provider.
+type UserIdentity struct {
+	ID        uint      `gorm:"primaryKey;column:user_identity_id"`
+	UserID    uint      `gorm:"column:user_id"`
+	Provider  string    `gorm:"column:provider;uniqueIndex:idx_user_identity_provider_subject"`
+	Subject   string    `gorm:"column:subject;uniqueIndex:idx_user_identity_provider_subject"`
+	Email     string    `gorm:"column:email"`
+	CreatedAt time.Time `gorm:"column:created_at"`
+}
+
+// RecoveryCode is a single-use backup code for two-factor login, stored as a
+// SHA-256 hash.
+type RecoveryCode struct {
+	ID        uint       `gorm:"primaryKey;column:recovery_code_id"`
+	UserID    uint       `gorm:"column:user_id"`
+	CodeHash  string     `gorm:"column:code_hash"`
+	UsedAt    *time.Time `gorm:"column:used_at"`
+	CreatedAt time.Time  `gorm:"column:created_at"`
+}
+
+// APIKey lets scripts and integrations call the API as its owner, limited
+// to its scopes. Only a SHA-256 hash of the key is stored; Prefix is kept in
+// clear so the owner can tell their keys apart.
+type APIKey struct {
+	ID         uint       `gorm:"primaryKey;column:api_key_id"`
+	UserID     uint       `gorm:"column:user_id;index"`
+	Name       string     `gorm:"column:name"`
+	Prefix     string     `gorm:"column:prefix"`
+	KeyHash    string     `gorm:"column:key_hash;uniqueIndex"`
+	Scopes     string     `gorm:"column:scopes"`
+	ExpiresAt  *time.Time `gorm:"column:expires_at"`
+	LastUsedAt *time.Time `gorm:"column:last_used_at"`
+	RevokedAt  *time.Time `gorm:"column:revoked_at"`
+	CreatedAt  time.Time  `gorm:"column:created_at"`
+}
+
+// ScopeList returns the key's scopes, which are stored space separated.
+func (k APIKey) ScopeList() []string {
+	return strings.Fields(k.Scopes)
+}
+
+// HasScope reports whether the key was granted the scope.
+func (k APIKey) HasScope(scope string) bool {
+	for _, granted := range k.ScopeList() {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Session groups the refresh tokens issued from a single login. Revoking the
+// session invalidates all of them and the access tokens that carry its ID.
+// AuthMethod is how the user signed in, a password or a login provider.
+type Session struct {
+	ID         string     `gorm:"primaryKey;column:session_id"`
+	UserID     uint       `gorm:"column:user_id"`
+	AuthMethod string     `gorm:"column:auth_method"`
+	TwoFactor  bool       `gorm:"column:two_factor"`
+	CreatedAt  time.Time  `gorm:"column:created_at"`
+	RevokedAt  *time.Time `gorm:"column:revoked_at"`
+}
+
+// RefreshToken is a single-use token, stored as a SHA-256 hash.
+type RefreshToken struct {
+	ID        uint       `gorm:"primaryKey;column:refresh_token_id"`
+	SessionID string     `gorm:"column:session_id"`
+	TokenHash string     `gorm:"column:token_hash;uniqueIndex"`
+	ExpiresAt time.Time  `gorm:"column:expires_at"`
+	CreatedAt time.Time  `gorm:"column:created_at"`
+	UsedAt    *time.Time `gorm:"column:used_at"`
+}
+
+// UserToken tracks the single-use tokens sent by email, such as email
+// verification and password reset tokens.
+type UserToken struct {
+	ID        string     `gorm:"primaryKey;column:token_id"`
+	UserID    uint       `gorm:"column:user_id"`
+	Purpose   string     `gorm:"column:purpose"`
+	ExpiresAt time.Time  `gorm:"column:expires_at"`
+	CreatedAt time.Time  `gorm:"column:created_at"`
+	UsedAt    *time.Time `gorm:"column:used_at"`
 }
 
 type Book struct {
-	ID      		uint   `gorm:"primaryKey;column:book_id"`
-	Title		  	string `gorm:"column:title" json:"title"`  
-	AuthorID    	uint `gorm:"column:author_id" json:"author"`
-	CategoryID		uint `gorm:"column:category_id" json:"category"`
-	Author     		Author
-    Category   		Category
-	Isbn			string `gorm:"column:isbn" json:"ISBN"`
-	Stock			uint   `gorm:"column:stock" json:"stock"`
-	Price			uint   `gorm:"column:price" json:"price"`
-	ReadingDays		uint   `gorm:"column:reading_days" json:"reading_days"`
+	ID          uint   `gorm:"primaryKey;column:book_id"`
+	Title       string `gorm:"column:title" json:"title"`
+	AuthorID    uint   `gorm:"column:author_id" json:"author"`
+	CategoryID  uint   `gorm:"column:category_id" json:"category"`
+	Author      Author
+	Category    Category
+	Isbn        string `gorm:"column:isbn" json:"ISBN"`
+	Stock       uint   `gorm:"column:stock" json:"stock"`
+	Price       uint   `gorm:"column:price" json:"price"`
+	ReadingDays uint   `gorm:"column:reading_days" json:"reading_days"`
+}
+
+const (
+	CopyAvailable = "available"
+	CopyRented    = "rented"
+)
+
+// BookCopy is a physical, barcoded copy of a book.
+type BookCopy struct {
+	ID      uint   `gorm:"primaryKey;column:copy_id" json:"copy_id"`
+	BookID  uint   `gorm:"column:book_id" json:"book_id"`
+	Barcode string `gorm:"column:barcode" json:"barcode"`
+	Status  string `gorm:"column:status" json:"status"`
 }
 
 type Author struct {
-	ID         uint   `gorm:"primaryKey;column:author_id"`
-	FirstName  string `gorm:"column:first_name" json:"first_name"`
-	LastName   string `gorm:"column:last_name" json:"last_name"`
+	ID          uint   `gorm:"primaryKey;column:author_id"`
+	FirstName   string `gorm:"column:first_name" json:"first_name"`
+	LastName    string `gorm:"column:last_name" json:"last_name"`
 	Nationality string `gorm:"column:nationality" json:"nationality"`
-	BirthDate  string `gorm:"column:birth_date" json:"birth_date"`
+	BirthDate   string `gorm:"column:birth_date" json:"birth_date"`
 }
 
 type Category struct {
@@ -44,28 +165,73 @@ type Category struct {
 }
 
 type Rental struct {
-	ID          uint   `gorm:"primaryKey;column:rental_id"`
-	UserID      uint   `gorm:"column:user_id" json:"user_id"`
-	RentalDate  *time.Time `gorm:"column:rental_date" json:"rental_date"`
-	RentalStatus string `gorm:"column:rental_status" json:"rental_status"`
-	TotalPrice   uint `gorm:"column:total_price" json:"total_price"`
+	ID           uint           `gorm:"primaryKey;column:rental_id"`
+	UserID       uint           `gorm:"column:user_id" json:"user_id"`
+	RentalDate   *time.Time     `gorm:"column:rental_date" json:"rental_date"`
+	RentalStatus RentalStatus   `gorm:"column:rental_status" json:"rental_status"`
+	TotalPrice   uint           `gorm:"column:total_price" json:"total_price"`
+	Details      []RentalDetail `gorm:"foreignKey:RentalID" json:"-"`
 }
 
 type RentalDetail struct {
-	ID         uint   `gorm:"primaryKey;column:rental_detail_id"`
-	RentalID   uint   `gorm:"column:rental_id" json:"rental_id"`
-	BookID     uint   `gorm:"column:book_id" json:"book_id"`
-	Returned   bool   `gorm:"column:returned" json:"returned"`
+	ID         uint       `gorm:"primaryKey;column:rental_detail_id"`
+	RentalID   uint       `gorm:"column:rental_id" json:"rental_id"`
+	BookID     uint       `gorm:"column:book_id" json:"book_id"`
+	Returned   bool       `gorm:"column:returned" json:"returned"`
+	DueDate    *time.Time `gorm:"column:due_date" json:"due_date"`
+	ReturnedAt *time.Time `gorm:"column:returned_at" json:"returned_at"`
+	CopyID     *uint      `gorm:"column:copy_id" json:"copy_id"`
+	Book       Book       `gorm:"foreignKey:BookID;references:ID" json:"-"`
+}
+
+// RentalStatusHistory records every status change of a rental.
+// ChangedBy is nil when the change was made by the system.
+type RentalStatusHistory struct {
+	ID         uint         `gorm:"primaryKey;column:history_id" json:"history_id"`
+	RentalID   uint         `gorm:"column:rental_id" json:"rental_id"`
+	FromStatus RentalStatus `gorm:"column:from_status" json:"from_status"`
+	ToStatus   RentalStatus `gorm:"column:to_status" json:"to_status"`
+	ChangedBy  *uint        `gorm:"column:changed_by" json:"changed_by"`
+	Note       string       `gorm:"column:note" json:"note"`
+	ChangedAt  time.Time    `gorm:"column:changed_at" json:"changed_at"`
 }
 
 type Payment struct {
-	ID            uint   `gorm:"primaryKey;column:payment_id"`
-	RentalID      uint   `gorm:"column:rental_id" json:"rental_id"`
-	PaymentDate   string `gorm:"column:payment_date" json:"payment_date"`
+	ID            uint    `gorm:"primaryKey;column:payment_id" json:"payment_id"`
+	RentalID      uint    `gorm:"column:rental_id" json:"rental_id"`
+	PaymentDate   string  `gorm:"column:payment_date" json:"payment_date"`
 	PaymentAmount float64 `gorm:"column:payment_amount" json:"payment_amount"`
+	InvoiceID     string  `gorm:"column:invoice_id" json:"invoice_id"`
+	InvoiceURL    string  `gorm:"column:invoice_url" json:"invoice_url"`
 }
 
 type Cart struct {
-	UserID				uint   `gorm:"column:user_id" json:"user_id"`
-	BookID      		uint   `gorm:"column:book_id" json:"book_id"`  
+	ID     uint `gorm:"primaryKey;column:cart_id" json:"cart_id"`
+	UserID uint `gorm:"column:user_id" json:"user_id"`
+	BookID uint `gorm:"column:book_id" json:"book_id"`
+}
+
+// IdempotencyKey stores the first response sent for a client supplied
+// Idempotency-Key so retries of the same request can be replayed.
+type IdempotencyKey struct {
+	ID           uint       `gorm:"primaryKey;column:idempotency_key_id"`
+	UserID       uint       `gorm:"column:user_id;uniqueIndex:idx_idempotency_user_key"`
+	Key          string     `gorm:"column:idempotency_key;uniqueIndex:idx_idempotency_user_key"`
+	Method       string     `gorm:"column:method"`
+	Path         string     `gorm:"column:path"`
+	RequestHash  string     `gorm:"column:request_hash"`
+	StatusCode   int        `gorm:"column:status_code"`
+	ContentType  string     `gorm:"column:content_type"`
+	ResponseBody string     `gorm:"column:response_body"`
+	CreatedAt    time.Time  `gorm:"column:created_at"`
+	CompletedAt  *time.Time `gorm:"column:completed_at"`
+}
+
+// LoginAttempt tracks failed logins for one limiter key, either an account
+// ("account:<email>") or a client IP ("ip:<address>").
+type LoginAttempt struct {
+	Key           string     `gorm:"primaryKey;column:attempt_key"`
+	Failures      int        `gorm:"column:failures"`
+	LastFailureAt time.Time  `gorm:"column:last_failure_at"`
+	BlockedUntil  *time.Time `gorm:"column:blocked_until"`
 }
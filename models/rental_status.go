@@ -0,0 +1,47 @@
+package models
+
+// RentalStatus is the lifecycle state of a rental.
+type RentalStatus string
+
+const (
+	RentalCreated           RentalStatus = "created"
+	RentalPendingPayment    RentalStatus = "pending_payment"
+	RentalPaid              RentalStatus = "paid"
+	RentalActive            RentalStatus = "active"
+	RentalPartiallyReturned RentalStatus = "partially_returned"
+	RentalReturned          RentalStatus = "returned"
+	RentalCancelled         RentalStatus = "cancelled"
+	RentalExpired           RentalStatus = "expired"
+	RentalOverdue           RentalStatus = "overdue"
+)
+
+// rentalTransitions lists the statuses a rental may move to from each status.
+// Statuses without an entry are final.
+var rentalTransitions = map[RentalStatus][]RentalStatus{
+	RentalCreated:           {RentalPendingPayment, RentalCancelled},
+	RentalPendingPayment:    {RentalPaid, RentalCancelled, RentalExpired},
+	RentalPaid:              {RentalActive, RentalCancelled},
+	RentalActive:            {RentalPartiallyReturned, RentalReturned, RentalOverdue},
+	RentalOverdue:           {RentalPartiallyReturned, RentalReturned},
+	RentalPartiallyReturned: {RentalReturned, RentalOverdue},
+}
+
+// Valid reports whether s is one of the known rental statuses.
+func (s RentalStatus) Valid() bool {
+	switch s {
+	case RentalCreated, RentalPendingPayment, RentalPaid, RentalActive,
+		RentalPartiallyReturned, RentalReturned, RentalCancelled, RentalExpired, RentalOverdue:
+		return true
+	}
+	return false
+}
+
+// CanTransitionTo reports whether a rental in status s may move to next.
+func (s RentalStatus) CanTransitionTo(next RentalStatus) bool {
+	for _, allowed := range rentalTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,174 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	gooidc "github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+var ErrNonceMismatch = errors.New("id token nonce does not match")
+
+// ProviderConfig describes one OpenID Connect identity provider.
+type ProviderConfig struct {
+	// Name identifies the provider in URLs, e.g. "google"
+	Name         string   `json:"name" yaml:"name"`
+	Issuer       string   `json:"issuer" yaml:"issuer"`
+	ClientID     string   `json:"client_id" yaml:"client_id"`
+	ClientSecret string   `json:"client_secret" yaml:"client_secret" secret:"true"`
+	RedirectURL  string   `json:"redirect_url" yaml:"redirect_url"`
+	Scopes       []string `json:"scopes" yaml:"scopes"`
+}
+
+// Identity is what we learn about the user from the provider's ID token.
+type Identity struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	GivenName     string
+	FamilyName    string
+}
+
+// Provider runs the authorization code flow with PKCE against one identity
+// provider. Its discovery document is fetched on first use, so a provider
+// that is down does not stop the service from starting.
+type Provider struct {
+	config ProviderConfig
+
+	mu       sync.Mutex
+	provider *gooidc.Provider
+}
+
+func (p *Provider) Name() string {
+	return p.config.Name
+}
+
+// AuthCodeURL returns the provider's login URL. The verifier is kept by the
+// caller and sent with the code in Exchange.
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	provider, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	return p.oauth2Config(provider).AuthCodeURL(state, gooidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier)), nil
+}
+
+// Exchange trades the authorization code for tokens and returns the verified
+// identity from the ID token.
+func (p *Provider) Exchange(ctx context.Context, code, verifier, nonce string) (*Identity, error) {
+	provider, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := p.oauth2Config(provider).Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return nil, fmt.Errorf("exchanging code: %w", err)
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok || rawIDToken == "" {
+		return nil, errors.New("token response has no id_token")
+	}
+
+	idToken, err := provider.Verifier(&gooidc.Config{ClientID: p.config.ClientID}).Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("verifying id token: %w", err)
+	}
+	if idToken.Nonce != nonce {
+		return nil, ErrNonceMismatch
+	}
+
+	var claims struct {
+		Email         string `json:"email"`
+		EmailVerified bool   `json:"email_verified"`
+		GivenName     string `json:"given_name"`
+		FamilyName    string `json:"family_name"`
+	}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("reading id token claims: %w", err)
+	}
+
+	return &Identity{
+		Provider:      p.config.Name,
+		Subject:       idToken.Subject,
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified,
+		GivenName:     claims.GivenName,
+		FamilyName:    claims.FamilyName,
+	}, nil
+}
+
+func (p *Provider) discover(ctx context.Context) (*gooidc.Provider, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.provider != nil {
+		return p.provider, nil
+	}
+
+	provider, err := gooidc.NewProvider(ctx, p.config.Issuer)
+	if err != nil {
+		return nil, fmt.Errorf("discovering %s: %w", p.config.Name, err)
+	}
+	p.provider = provider
+	return provider, nil
+}
+
+func (p *Provider) oauth2Config(provider *gooidc.Provider) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     p.config.ClientID,
+		ClientSecret: p.config.ClientSecret,
+		RedirectURL:  p.config.RedirectURL,
+		Endpoint:     provider.Endpoint(),
+		Scopes:       p.config.Scopes,
+	}
+}
+
+// Registry holds the configured identity providers by name.
+type Registry struct {
+	providers map[string]*Provider
+	names     []string
+}
+
+// NewRegistry checks the provider configs and builds a registry. Providers
+// without scopes ask for "openid email profile".
+func NewRegistry(configs []ProviderConfig) (*Registry, error) {
+	r := &Registry{providers: map[string]*Provider{}}
+	for _, cfg := range configs {
+		switch {
+		case cfg.Name == "":
+			return nil, errors.New("OIDC provider name is required")
+		case cfg.Issuer == "" || cfg.ClientID == "" || cfg.RedirectURL == "":
+			return nil, fmt.Errorf("OIDC provider %q needs issuer, client_id and redirect_url", cfg.Name)
+		}
+		if _, exists := r.providers[cfg.Name]; exists {
+			return nil, fmt.Errorf("duplicate OIDC provider %q", cfg.Name)
+		}
+		if len(cfg.Scopes) == 0 {
+			cfg.Scopes = []string{gooidc.ScopeOpenID, "email", "profile"}
+		}
+
+		r.providers[cfg.Name] = &Provider{config: cfg}
+		r.names = append(r.names, cfg.Name)
+	}
+	return r, nil
+}
+
+// Get returns the provider with the given name.
+func (r *Registry) Get(name string) (*Provider, bool) {
+	provider, ok := r.providers[name]
+	return provider, ok
+}
+
+// Names lists the configured providers in configuration order.
+func (r *Registry) Names() []string {
+	return append([]string{}, r.names...)
+}
+
+// GenerateVerifier returns a new random PKCE code verifier.
+func GenerateVerifier() string {
+	return oauth2.GenerateVerifier()
+}
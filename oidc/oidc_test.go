@@ -0,0 +1,146 @@
+package oidc_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"finalp2/oidc"
+	"finalp2/oidc/oidctest"
+)
+
+const redirectURL = "http://app.test/users/oidc/mock/callback"
+
+func newProvider(t *testing.T, user oidctest.User) (*oidctest.Provider, *oidc.Provider) {
+	t.Helper()
+	mock := oidctest.NewProvider("client-id", user)
+	t.Cleanup(mock.Close)
+
+	registry, err := oidc.NewRegistry([]oidc.ProviderConfig{{
+		Name:         "mock",
+		Issuer:       mock.Issuer(),
+		ClientID:     "client-id",
+		ClientSecret: "secret",
+		RedirectURL:  redirectURL,
+	}})
+	if err != nil {
+		t.Fatalf("NewRegistry: %v", err)
+	}
+	provider, ok := registry.Get("mock")
+	if !ok {
+		t.Fatal("provider mock not registered")
+	}
+	return mock, provider
+}
+
+// authorize follows the login URL to the mock provider and returns the code
+// and state it redirects back with.
+func authorize(t *testing.T, loginURL string) (code, state string) {
+	t.Helper()
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(loginURL)
+	if err != nil {
+		t.Fatalf("authorize: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("authorize status = %d, want 302", resp.StatusCode)
+	}
+
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatalf("redirect location: %v", err)
+	}
+	return location.Query().Get("code"), location.Query().Get("state")
+}
+
+func TestExchange(t *testing.T) {
+	_, provider := newProvider(t, oidctest.User{
+		Subject:       "sub-1",
+		Email:         "reader@example.com",
+		EmailVerified: true,
+		GivenName:     "Ada",
+		FamilyName:    "Reader",
+	})
+	ctx := context.Background()
+	verifier := oidc.GenerateVerifier()
+
+	loginURL, err := provider.AuthCodeURL(ctx, "state-1", "nonce-1", verifier)
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+	code, state := authorize(t, loginURL)
+	if state != "state-1" {
+		t.Fatalf("state = %q, want state-1", state)
+	}
+
+	identity, err := provider.Exchange(ctx, code, verifier, "nonce-1")
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	want := oidc.Identity{
+		Provider:      "mock",
+		Subject:       "sub-1",
+		Email:         "reader@example.com",
+		EmailVerified: true,
+		GivenName:     "Ada",
+		FamilyName:    "Reader",
+	}
+	if *identity != want {
+		t.Fatalf("identity = %+v, want %+v", *identity, want)
+	}
+
+	if _, err := provider.Exchange(ctx, code, verifier, "nonce-1"); err == nil {
+		t.Fatal("Exchange accepted a code twice")
+	}
+}
+
+func TestExchangeRejectsWrongVerifier(t *testing.T) {
+	_, provider := newProvider(t, oidctest.User{Subject: "sub-1"})
+	ctx := context.Background()
+
+	loginURL, err := provider.AuthCodeURL(ctx, "state-1", "nonce-1", oidc.GenerateVerifier())
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+	code, _ := authorize(t, loginURL)
+
+	if _, err := provider.Exchange(ctx, code, oidc.GenerateVerifier(), "nonce-1"); err == nil {
+		t.Fatal("Exchange accepted a different PKCE verifier")
+	}
+}
+
+func TestExchangeRejectsNonceMismatch(t *testing.T) {
+	_, provider := newProvider(t, oidctest.User{Subject: "sub-1"})
+	ctx := context.Background()
+	verifier := oidc.GenerateVerifier()
+
+	loginURL, err := provider.AuthCodeURL(ctx, "state-1", "nonce-1", verifier)
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+	code, _ := authorize(t, loginURL)
+
+	if _, err := provider.Exchange(ctx, code, verifier, "nonce-2"); !errors.Is(err, oidc.ErrNonceMismatch) {
+		t.Fatalf("Exchange error = %v, want ErrNonceMismatch", err)
+	}
+}
+
+func TestNewRegistryRejectsInvalidConfig(t *testing.T) {
+	valid := oidc.ProviderConfig{Name: "mock", Issuer: "http://idp.test", ClientID: "id", RedirectURL: redirectURL}
+
+	tests := map[string][]oidc.ProviderConfig{
+		"missing name":   {{Issuer: "http://idp.test", ClientID: "id", RedirectURL: redirectURL}},
+		"missing issuer": {{Name: "mock", ClientID: "id", RedirectURL: redirectURL}},
+		"duplicate":      {valid, valid},
+	}
+	for name, configs := range tests {
+		if _, err := oidc.NewRegistry(configs); err == nil {
+			t.Errorf("%s: NewRegistry accepted %+v", name, configs)
+		}
+	}
+}
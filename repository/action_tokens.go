@@ -0,0 +1,50 @@
+package repository
+
+import (
+	"finalp2/auth"
+	"finalp2/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ActionTokenRepository keeps the single-use tokens sent by email and the
+// two-factor login challenges.
+type ActionTokenRepository interface {
+	Issue(keys *auth.KeyManager, user models.User, purpose string, ttl time.Duration) (string, error)
+	IssueTwoFactorChallenge(keys *auth.KeyManager, user models.User, method string) (string, error)
+	// Consume uses up the token and returns the user it was issued to.
+	Consume(keys *auth.KeyManager, token, purpose string) (uint, error)
+	// PeekTwoFactorChallenge checks the challenge without using it up and
+	// returns the user and how they signed in.
+	PeekTwoFactorChallenge(keys *auth.KeyManager, token string) (uint, string, error)
+	DeleteAll(userID uint) error
+}
+
+type actionTokenRepository struct {
+	db *gorm.DB
+}
+
+func NewActionTokenRepository(db *gorm.DB) ActionTokenRepository {
+	return &actionTokenRepository{db: db}
+}
+
+func (r *actionTokenRepository) Issue(keys *auth.KeyManager, user models.User, purpose string, ttl time.Duration) (string, error) {
+	return auth.IssueActionToken(r.db, keys, user, purpose, ttl)
+}
+
+func (r *actionTokenRepository) IssueTwoFactorChallenge(keys *auth.KeyManager, user models.User, method string) (string, error) {
+	return auth.IssueTwoFactorChallenge(r.db, keys, user, method)
+}
+
+func (r *actionTokenRepository) Consume(keys *auth.KeyManager, token, purpose string) (uint, error) {
+	return auth.ConsumeActionToken(r.db, keys, token, purpose)
+}
+
+func (r *actionTokenRepository) PeekTwoFactorChallenge(keys *auth.KeyManager, token string) (uint, string, error) {
+	return auth.PeekTwoFactorChallenge(r.db, keys, token)
+}
+
+func (r *actionTokenRepository) DeleteAll(userID uint) error {
+	return r.db.Where("user_id = ?", userID).Delete(&models.UserToken{}).Error
+}
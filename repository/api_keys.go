@@ -0,0 +1,65 @@
+package repository
+
+import (
+	"finalp2/auth"
+	"finalp2/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// APIKeyRepository stores the users' API keys. Creating and revoking them is
+// left to the auth package, which also checks them on every request.
+type APIKeyRepository interface {
+	// CountActive counts the user's keys that are neither revoked nor
+	// expired.
+	CountActive(userID uint) (int64, error)
+	// List returns every key of the user, revoked and expired ones included.
+	List(userID uint) ([]models.APIKey, error)
+	// Create returns the new key and the key itself, which is not stored.
+	Create(userID uint, name string, scopes []string, expiresAt *time.Time) (*models.APIKey, string, error)
+	// Revoke reports whether the user had such an active key.
+	Revoke(userID, keyID uint) (bool, error)
+	RevokeAll(userID uint) error
+	DeleteAll(userID uint) error
+}
+
+type apiKeyRepository struct {
+	db *gorm.DB
+}
+
+func NewAPIKeyRepository(db *gorm.DB) APIKeyRepository {
+	return &apiKeyRepository{db: db}
+}
+
+func (r *apiKeyRepository) CountActive(userID uint) (int64, error) {
+	var active int64
+	err := r.db.Model(&models.APIKey{}).
+		Where("user_id = ? AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?)", userID, time.Now()).
+		Count(&active).Error
+	return active, err
+}
+
+func (r *apiKeyRepository) List(userID uint) ([]models.APIKey, error) {
+	var keys []models.APIKey
+	if err := r.db.Where("user_id = ?", userID).Order("api_key_id").Find(&keys).Error; err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+func (r *apiKeyRepository) Create(userID uint, name string, scopes []string, expiresAt *time.Time) (*models.APIKey, string, error) {
+	return auth.CreateAPIKey(r.db, userID, name, scopes, expiresAt)
+}
+
+func (r *apiKeyRepository) Revoke(userID, keyID uint) (bool, error) {
+	return auth.RevokeAPIKey(r.db, userID, keyID)
+}
+
+func (r *apiKeyRepository) RevokeAll(userID uint) error {
+	return auth.RevokeUserAPIKeys(r.db, userID)
+}
+
+func (r *apiKeyRepository) DeleteAll(userID uint) error {
+	return r.db.Where("user_id = ?", userID).Delete(&models.APIKey{}).Error
+}
@@ -0,0 +1,97 @@
+package repository
+
+import (
+	"finalp2/models"
+
+	"gorm.io/gorm"
+)
+
+// BookRepository stores the catalogue and the physical copies of each book.
+// Books are returned with their author and category.
+type BookRepository interface {
+	List() ([]models.Book, error)
+	FindByID(id uint) (*models.Book, error)
+	// FindByIDs returns the books with the given IDs, in no particular order.
+	FindByIDs(ids []uint) ([]models.Book, error)
+	IncrementStock(id uint) error
+
+	// ReserveCopy marks an available copy of the book as rented and returns
+	// it. It returns nil without an error when the book has no available copy.
+	ReserveCopy(bookID uint) (*models.BookCopy, error)
+	// ReleaseCopy puts a rented copy back on the shelf.
+	ReleaseCopy(copyID uint) error
+}
+
+type bookRepository struct {
+	db *gorm.DB
+}
+
+func NewBookRepository(db *gorm.DB) BookRepository {
+	return &bookRepository{db: db}
+}
+
+func (r *bookRepository) withRelations() *gorm.DB {
+	return r.db.Preload("Author").Preload("Category")
+}
+
+func (r *bookRepository) List() ([]models.Book, error) {
+	var books []models.Book
+	if err := r.withRelations().Order("book_id").Find(&books).Error; err != nil {
+		return nil, err
+	}
+	return books, nil
+}
+
+func (r *bookRepository) FindByID(id uint) (*models.Book, error) {
+	var book models.Book
+	if err := first(r.withRelations().Where("book_id = ?", id), &book); err != nil {
+		return nil, err
+	}
+	return &book, nil
+}
+
+func (r *bookRepository) FindByIDs(ids []uint) ([]models.Book, error) {
+	var books []models.Book
+	if len(ids) == 0 {
+		return books, nil
+	}
+	if err := r.withRelations().Where("book_id IN ?", ids).Find(&books).Error; err != nil {
+		return nil, err
+	}
+	return books, nil
+}
+
+func (r *bookRepository) IncrementStock(id uint) error {
+	return r.db.Model(&models.Book{}).Where("book_id = ?", id).UpdateColumn("stock", gorm.Expr("stock + 1")).Error
+}
+
+func (r *bookRepository) ReserveCopy(bookID uint) (*models.BookCopy, error) {
+	for attempt := 0; attempt < 3; attempt++ {
+		var bookCopy models.BookCopy
+		result := r.db.Where("book_id = ? AND status = ?", bookID, models.CopyAvailable).Order("copy_id").Limit(1).Find(&bookCopy)
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil, nil
+		}
+
+		// Only take the copy if nobody else reserved it in the meantime
+		result = r.db.Model(&models.BookCopy{}).
+			Where("copy_id = ? AND status = ?", bookCopy.ID, models.CopyAvailable).
+			Update("status", models.CopyRented)
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		if result.RowsAffected == 1 {
+			bookCopy.Status = models.CopyRented
+			return &bookCopy, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (r *bookRepository) ReleaseCopy(copyID uint) error {
+	return r.db.Model(&models.BookCopy{}).Where("copy_id = ?", copyID).Update("status", models.CopyAvailable).Error
+}
@@ -0,0 +1,53 @@
+package repository
+
+import (
+	"finalp2/models"
+
+	"gorm.io/gorm"
+)
+
+// CartRepository stores the books users put in their cart before checkout.
+type CartRepository interface {
+	List(userID uint) ([]models.Cart, error)
+	Add(cart *models.Cart) error
+	// RemoveFirst removes the user's oldest cart item and reports whether
+	// there was one.
+	RemoveFirst(userID uint) (bool, error)
+	Clear(userID uint) error
+}
+
+type cartRepository struct {
+	db *gorm.DB
+}
+
+func NewCartRepository(db *gorm.DB) CartRepository {
+	return &cartRepository{db: db}
+}
+
+func (r *cartRepository) List(userID uint) ([]models.Cart, error) {
+	var carts []models.Cart
+	if err := r.db.Where("user_id = ?", userID).Order("cart_id").Find(&carts).Error; err != nil {
+		return nil, err
+	}
+	return carts, nil
+}
+
+func (r *cartRepository) Add(cart *models.Cart) error {
+	return r.db.Create(cart).Error
+}
+
+func (r *cartRepository) RemoveFirst(userID uint) (bool, error) {
+	var cart models.Cart
+	err := first(r.db.Where("user_id = ?", userID).Order("cart_id"), &cart)
+	if err == ErrNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, r.db.Delete(&cart).Error
+}
+
+func (r *cartRepository) Clear(userID uint) error {
+	return r.db.Where("user_id = ?", userID).Delete(&models.Cart{}).Error
+}
@@ -0,0 +1,40 @@
+package repository
+
+import (
+	"finalp2/models"
+
+	"gorm.io/gorm"
+)
+
+// IdentityRepository stores the links between users and their accounts at
+// OpenID Connect providers.
+type IdentityRepository interface {
+	// FindBySubject returns the link of the provider account.
+	FindBySubject(provider, subject string) (*models.UserIdentity, error)
+	Create(identity *models.UserIdentity) error
+	DeleteAll(userID uint) error
+}
+
+type identityRepository struct {
+	db *gorm.DB
+}
+
+func NewIdentityRepository(db *gorm.DB) IdentityRepository {
+	return &identityRepository{db: db}
+}
+
+func (r *identityRepository) FindBySubject(provider, subject string) (*models.UserIdentity, error) {
+	var identity models.UserIdentity
+	if err := first(r.db.Where("provider = ? AND subject = ?", provider, subject), &identity); err != nil {
+		return nil, err
+	}
+	return &identity, nil
+}
+
+func (r *identityRepository) Create(identity *models.UserIdentity) error {
+	return r.db.Create(identity).Error
+}
+
+func (r *identityRepository) DeleteAll(userID uint) error {
+	return r.db.Where("user_id = ?", userID).Delete(&models.UserIdentity{}).Error
+}
@@ -0,0 +1,39 @@
+package repository
+
+import (
+	"finalp2/models"
+
+	"gorm.io/gorm"
+)
+
+// PaymentRepository stores the payments made for rentals.
+type PaymentRepository interface {
+	Create(payment *models.Payment) error
+	Save(payment *models.Payment) error
+	// ListByRental returns the rental's payments, oldest first.
+	ListByRental(rentalID uint) ([]models.Payment, error)
+}
+
+type paymentRepository struct {
+	db *gorm.DB
+}
+
+func NewPaymentRepository(db *gorm.DB) PaymentRepository {
+	return &paymentRepository{db: db}
+}
+
+func (r *paymentRepository) Create(payment *models.Payment) error {
+	return r.db.Create(payment).Error
+}
+
+func (r *paymentRepository) Save(payment *models.Payment) error {
+	return r.db.Save(payment).Error
+}
+
+func (r *paymentRepository) ListByRental(rentalID uint) ([]models.Payment, error) {
+	var payments []models.Payment
+	if err := r.db.Where("rental_id = ?", rentalID).Order("payment_id").Find(&payments).Error; err != nil {
+		return nil, err
+	}
+	return payments, nil
+}
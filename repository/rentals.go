@@ -0,0 +1,242 @@
+package repository
+
+import (
+	"errors"
+	"finalp2/models"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrIllegalTransition = errors.New("illegal rental status transition")
+
+// ErrStatusConflict means the rental's status was changed by someone else
+// since it was loaded.
+var ErrStatusConflict = errors.New("rental status changed concurrently")
+
+// RentalFilter narrows a user's rental history. Zero values don't filter.
+type RentalFilter struct {
+	Statuses []models.RentalStatus
+	// From and To limit the rental date; To is exclusive.
+	From *time.Time
+	To   *time.Time
+}
+
+// RentalRepository stores rentals, their items and their status history.
+type RentalRepository interface {
+	FindByID(id uint) (*models.Rental, error)
+	// List returns one page of the user's rentals, newest first, with their
+	// items and books, and the number of rentals matching the filter.
+	List(userID uint, filter RentalFilter, offset, limit int) ([]models.Rental, int64, error)
+	Create(rental *models.Rental) error
+	Update(rental *models.Rental, fields map[string]interface{}) error
+	// CountByStatus counts the user's rentals in any of the statuses.
+	CountByStatus(userID uint, statuses []models.RentalStatus) (int64, error)
+
+	// Transition moves the rental to the given status and records the change
+	// in the status history. It fails with ErrStatusConflict when the stored
+	// status no longer is the rental's, so of two concurrent requests only one
+	// moves it on. changedBy is the acting user, or nil when the change is
+	// made by the system.
+	Transition(rental *models.Rental, to models.RentalStatus, changedBy *uint, note string) error
+	// RecordStatus appends an entry to the rental status history.
+	RecordStatus(rentalID uint, from, to models.RentalStatus, changedBy *uint, note string) error
+
+	// Details returns the rental's items with their books, in order.
+	Details(rentalID uint) ([]models.RentalDetail, error)
+	AddDetail(detail *models.RentalDetail) error
+	UpdateDetail(detail *models.RentalDetail, fields map[string]interface{}) error
+	// FindDetail looks up an item by ID. When owner is set, only that user's
+	// rentals are searched.
+	FindDetail(owner *uint, id uint) (*models.RentalDetail, error)
+	// FindOutstandingByBarcode looks up the unreturned item the copy with the
+	// barcode was handed out for.
+	FindOutstandingByBarcode(owner *uint, barcode string) (*models.RentalDetail, error)
+	// FindOutstandingByBook returns the user's unreturned item of the book in
+	// one of the statuses that is due first.
+	FindOutstandingByBook(userID, bookID uint, statuses []models.RentalStatus) (*models.RentalDetail, error)
+	// MarkReturned marks an unreturned item as returned and reports whether
+	// it was still outstanding.
+	MarkReturned(detailID uint, at time.Time) (bool, error)
+	CountOutstanding(rentalID uint) (int64, error)
+}
+
+type rentalRepository struct {
+	db *gorm.DB
+}
+
+func NewRentalRepository(db *gorm.DB) RentalRepository {
+	return &rentalRepository{db: db}
+}
+
+func (r *rentalRepository) FindByID(id uint) (*models.Rental, error) {
+	var rental models.Rental
+	if err := first(r.db.Where("rental_id = ?", id), &rental); err != nil {
+		return nil, err
+	}
+	return &rental, nil
+}
+
+func (r *rentalRepository) List(userID uint, filter RentalFilter, offset, limit int) ([]models.Rental, int64, error) {
+	query := r.db.Model(&models.Rental{}).Where("user_id = ?", userID)
+	if len(filter.Statuses) > 0 {
+		query = query.Where("rental_status IN ?", filter.Statuses)
+	}
+	if filter.From != nil {
+		query = query.Where("rental_date >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("rental_date < ?", *filter.To)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var rentals []models.Rental
+	err := query.
+		Preload("Details", func(db *gorm.DB) *gorm.DB { return db.Order("rental_detail_id") }).
+		Preload("Details.Book.Author").
+		Preload("Details.Book.Category").
+		Order("rental_id DESC").
+		Offset(offset).
+		Limit(limit).
+		Find(&rentals).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	return rentals, total, nil
+}
+
+func (r *rentalRepository) Create(rental *models.Rental) error {
+	return r.db.Create(rental).Error
+}
+
+func (r *rentalRepository) Update(rental *models.Rental, fields map[string]interface{}) error {
+	return r.db.Model(rental).Omit(clause.Associations).Updates(fields).Error
+}
+
+func (r *rentalRepository) CountByStatus(userID uint, statuses []models.RentalStatus) (int64, error) {
+	var count int64
+	err := r.db.Model(&models.Rental{}).
+		Where("user_id = ? AND rental_status IN ?", userID, statuses).
+		Count(&count).Error
+	return count, err
+}
+
+func (r *rentalRepository) Transition(rental *models.Rental, to models.RentalStatus, changedBy *uint, note string) error {
+	from := rental.RentalStatus
+	if !from.CanTransitionTo(to) {
+		return fmt.Errorf("%w: %s -> %s", ErrIllegalTransition, from, to)
+	}
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		// Guard against the rental being moved on concurrently
+		result := tx.Model(&models.Rental{}).
+			Where("rental_id = ? AND rental_status = ?", rental.ID, from).
+			Update("rental_status", to)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("%w: rental %d is no longer %s", ErrStatusConflict, rental.ID, from)
+		}
+
+		return NewRentalRepository(tx).RecordStatus(rental.ID, from, to, changedBy, note)
+	})
+	if err != nil {
+		return err
+	}
+	rental.RentalStatus = to
+	return nil
+}
+
+func (r *rentalRepository) RecordStatus(rentalID uint, from, to models.RentalStatus, changedBy *uint, note string) error {
+	history := models.RentalStatusHistory{
+		RentalID:   rentalID,
+		FromStatus: from,
+		ToStatus:   to,
+		ChangedBy:  changedBy,
+		Note:       note,
+		ChangedAt:  time.Now(),
+	}
+	return r.db.Create(&history).Error
+}
+
+func (r *rentalRepository) Details(rentalID uint) ([]models.RentalDetail, error) {
+	var details []models.RentalDetail
+	err := r.db.Preload("Book.Author").Preload("Book.Category").
+		Where("rental_id = ?", rentalID).
+		Order("rental_detail_id").
+		Find(&details).Error
+	if err != nil {
+		return nil, err
+	}
+	return details, nil
+}
+
+func (r *rentalRepository) AddDetail(detail *models.RentalDetail) error {
+	return r.db.Omit(clause.Associations).Create(detail).Error
+}
+
+func (r *rentalRepository) UpdateDetail(detail *models.RentalDetail, fields map[string]interface{}) error {
+	return r.db.Model(detail).Omit(clause.Associations).Updates(fields).Error
+}
+
+// details returns a query over rental details joined with their rental, only
+// of the owner's rentals when owner is set.
+func (r *rentalRepository) details(owner *uint) *gorm.DB {
+	query := r.db.Model(&models.RentalDetail{}).Joins("JOIN rentals ON rentals.rental_id = rental_details.rental_id")
+	if owner != nil {
+		query = query.Where("rentals.user_id = ?", *owner)
+	}
+	return query
+}
+
+func (r *rentalRepository) FindDetail(owner *uint, id uint) (*models.RentalDetail, error) {
+	var detail models.RentalDetail
+	if err := first(r.details(owner).Where("rental_details.rental_detail_id = ?", id), &detail); err != nil {
+		return nil, err
+	}
+	return &detail, nil
+}
+
+func (r *rentalRepository) FindOutstandingByBarcode(owner *uint, barcode string) (*models.RentalDetail, error) {
+	var detail models.RentalDetail
+	query := r.details(owner).
+		Joins("JOIN book_copies ON book_copies.copy_id = rental_details.copy_id").
+		Where("book_copies.barcode = ? AND rental_details.returned = ?", barcode, false)
+	if err := first(query, &detail); err != nil {
+		return nil, err
+	}
+	return &detail, nil
+}
+
+func (r *rentalRepository) FindOutstandingByBook(userID, bookID uint, statuses []models.RentalStatus) (*models.RentalDetail, error) {
+	var detail models.RentalDetail
+	query := r.details(&userID).
+		Where("rental_details.book_id = ? AND rental_details.returned = ?", bookID, false).
+		Where("rentals.rental_status IN ?", statuses).
+		Order("rental_details.due_date, rental_details.rental_detail_id")
+	if err := first(query, &detail); err != nil {
+		return nil, err
+	}
+	return &detail, nil
+}
+
+func (r *rentalRepository) MarkReturned(detailID uint, at time.Time) (bool, error) {
+	// Guard against the item being returned concurrently
+	result := r.db.Model(&models.RentalDetail{}).
+		Where("rental_detail_id = ? AND returned = ?", detailID, false).
+		Updates(map[string]interface{}{"returned": true, "returned_at": at})
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *rentalRepository) CountOutstanding(rentalID uint) (int64, error) {
+	var count int64
+	err := r.db.Model(&models.RentalDetail{}).Where("rental_id = ? AND returned = ?", rentalID, false).Count(&count).Error
+	return count, err
+}
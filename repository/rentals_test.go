@@ -0,0 +1,40 @@
+package repository_test
+
+import (
+	"errors"
+	"testing"
+
+	"finalp2/models"
+	"finalp2/repository"
+	"finalp2/routes/routestest"
+)
+
+func TestTransitionRejectsStaleStatus(t *testing.T) {
+	app := routestest.New(t)
+	rentals := repository.NewRentalRepository(app.DB)
+	rental := models.Rental{UserID: app.User(t, routestest.UserEmail).ID, RentalStatus: models.RentalPendingPayment}
+	if err := rentals.Create(&rental); err != nil {
+		t.Fatal(err)
+	}
+	// A second request loaded the rental before the first moved it on
+	stale := rental
+
+	if err := rentals.Transition(&rental, models.RentalPaid, nil, "first"); err != nil {
+		t.Fatalf("first Transition: %v", err)
+	}
+	err := rentals.Transition(&stale, models.RentalPaid, nil, "second")
+	if !errors.Is(err, repository.ErrStatusConflict) {
+		t.Fatalf("second Transition = %v, want ErrStatusConflict", err)
+	}
+	if stale.RentalStatus != models.RentalPendingPayment {
+		t.Fatalf("stale rental status = %s after the conflict", stale.RentalStatus)
+	}
+
+	var history []models.RentalStatusHistory
+	if err := app.DB.Where("rental_id = ?", rental.ID).Find(&history).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 1 || history[0].Note != "first" {
+		t.Fatalf("history = %+v, want only the first change", history)
+	}
+}
@@ -0,0 +1,106 @@
+// Package repository hides the database behind one interface per aggregate,
+// so the services can be tested without Postgres. The gorm implementations
+// are returned by NewStore and the New*Repository constructors.
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+// ErrNotFound is returned by the Find methods when there is no such row.
+var ErrNotFound = errors.New("record not found")
+
+// Store gives access to every repository. The repositories of the Store
+// passed to Transaction's callback all share the same transaction.
+type Store interface {
+	Users() UserRepository
+	Books() BookRepository
+	Carts() CartRepository
+	Rentals() RentalRepository
+	Payments() PaymentRepository
+	APIKeys() APIKeyRepository
+	Identities() IdentityRepository
+	Sessions() SessionRepository
+	ActionTokens() ActionTokenRepository
+	TwoFactor() TwoFactorRepository
+
+	// Transaction commits when fn returns nil and rolls back otherwise.
+	Transaction(fn func(Store) error) error
+	// WithContext returns a Store whose queries are cancelled with ctx.
+	WithContext(ctx context.Context) Store
+}
+
+type gormStore struct {
+	db *gorm.DB
+}
+
+// NewStore returns a Store backed by db.
+func NewStore(db *gorm.DB) Store {
+	return &gormStore{db: db}
+}
+
+func (s *gormStore) Users() UserRepository {
+	return NewUserRepository(s.db)
+}
+
+func (s *gormStore) Books() BookRepository {
+	return NewBookRepository(s.db)
+}
+
+func (s *gormStore) Carts() CartRepository {
+	return NewCartRepository(s.db)
+}
+
+func (s *gormStore) Rentals() RentalRepository {
+	return NewRentalRepository(s.db)
+}
+
+func (s *gormStore) Payments() PaymentRepository {
+	return NewPaymentRepository(s.db)
+}
+
+func (s *gormStore) APIKeys() APIKeyRepository {
+	return NewAPIKeyRepository(s.db)
+}
+
+func (s *gormStore) Identities() IdentityRepository {
+	return NewIdentityRepository(s.db)
+}
+
+func (s *gormStore) Sessions() SessionRepository {
+	return NewSessionRepository(s.db)
+}
+
+func (s *gormStore) ActionTokens() ActionTokenRepository {
+	return NewActionTokenRepository(s.db)
+}
+
+func (s *gormStore) TwoFactor() TwoFactorRepository {
+	return NewTwoFactorRepository(s.db)
+}
+
+func (s *gormStore) Transaction(fn func(Store) error) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		return fn(&gormStore{db: tx})
+	})
+}
+
+func (s *gormStore) WithContext(ctx context.Context) Store {
+	return &gormStore{db: s.db.WithContext(ctx)}
+}
+
+// first loads the first row matching the query into dest, translating a
+// missing row into ErrNotFound.
+func first(query *gorm.DB, dest interface{}) error {
+	result := query.Limit(1).Find(dest)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package repository
+
+import (
+	"finalp2/auth"
+	"finalp2/models"
+
+	"gorm.io/gorm"
+)
+
+// SessionRepository keeps the login sessions and their refresh tokens. The
+// tokens are made by the auth package and signed with the keys passed in.
+type SessionRepository interface {
+	// Issue starts a session and returns its first token pair.
+	Issue(keys *auth.KeyManager, user models.User, method string, twoFactor bool) (*auth.TokenPair, error)
+	// Refresh exchanges a refresh token for the next pair of its session.
+	Refresh(keys *auth.KeyManager, refreshToken string) (*auth.TokenPair, error)
+	Revoke(sessionID string) error
+	RevokeAll(userID uint) error
+	// RevokeOthers ends every session of the user but the kept one.
+	RevokeOthers(userID uint, keepSessionID string) error
+}
+
+type sessionRepository struct {
+	db *gorm.DB
+}
+
+func NewSessionRepository(db *gorm.DB) SessionRepository {
+	return &sessionRepository{db: db}
+}
+
+func (r *sessionRepository) Issue(keys *auth.KeyManager, user models.User, method string, twoFactor bool) (*auth.TokenPair, error) {
+	return auth.IssueTokens(r.db, keys, user, method, twoFactor)
+}
+
+func (r *sessionRepository) Refresh(keys *auth.KeyManager, refreshToken string) (*auth.TokenPair, error) {
+	return auth.RefreshTokens(r.db, keys, refreshToken)
+}
+
+func (r *sessionRepository) Revoke(sessionID string) error {
+	return auth.RevokeSession(r.db, sessionID)
+}
+
+func (r *sessionRepository) RevokeAll(userID uint) error {
+	return auth.RevokeUserSessions(r.db, userID)
+}
+
+func (r *sessionRepository) RevokeOthers(userID uint, keepSessionID string) error {
+	return auth.RevokeOtherSessions(r.db, userID, keepSessionID)
+}
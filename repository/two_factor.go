@@ -0,0 +1,38 @@
+package repository
+
+import (
+	"finalp2/auth"
+	"finalp2/models"
+
+	"gorm.io/gorm"
+)
+
+// TwoFactorRepository checks two-factor codes and keeps the recovery codes.
+type TwoFactorRepository interface {
+	// Verify accepts a current TOTP code or an unused recovery code, each
+	// only once, and returns auth.ErrInvalidTwoFactorCode otherwise.
+	Verify(user models.User, code string) error
+	// GenerateRecoveryCodes replaces the user's recovery codes.
+	GenerateRecoveryCodes(userID uint) ([]string, error)
+	DeleteRecoveryCodes(userID uint) error
+}
+
+type twoFactorRepository struct {
+	db *gorm.DB
+}
+
+func NewTwoFactorRepository(db *gorm.DB) TwoFactorRepository {
+	return &twoFactorRepository{db: db}
+}
+
+func (r *twoFactorRepository) Verify(user models.User, code string) error {
+	return auth.VerifyTwoFactor(r.db, user, code)
+}
+
+func (r *twoFactorRepository) GenerateRecoveryCodes(userID uint) ([]string, error) {
+	return auth.GenerateRecoveryCodes(r.db, userID)
+}
+
+func (r *twoFactorRepository) DeleteRecoveryCodes(userID uint) error {
+	return r.db.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error
+}
@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"finalp2/models"
+
+	"gorm.io/gorm"
+)
+
+// UserRepository stores users. Deleted users keep their row with DeletedAt
+// set; FindByID still returns them, FindActiveByEmail does not.
+type UserRepository interface {
+	FindByID(id uint) (*models.User, error)
+	FindActiveByEmail(email string) (*models.User, error)
+	// Create leaves the birth date NULL when it is empty.
+	Create(user *models.User) error
+	// Update sets the given columns of the user.
+	Update(id uint, fields map[string]interface{}) error
+	// ReplacePasswordHash only changes the hash when it is still oldHash, so
+	// a concurrent password change wins. It reports whether it did.
+	ReplacePasswordHash(id uint, oldHash, newHash string) (bool, error)
+	// AddDeposit atomically adds amount to the deposit and returns the new
+	// balance.
+	AddDeposit(id uint, amount uint) (uint, error)
+}
+
+type userRepository struct {
+	db *gorm.DB
+}
+
+func NewUserRepository(db *gorm.DB) UserRepository {
+	return &userRepository{db: db}
+}
+
+func (r *userRepository) FindByID(id uint) (*models.User, error) {
+	var user models.User
+	if err := first(r.db.Where("user_id = ?", id), &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (r *userRepository) FindActiveByEmail(email string) (*models.User, error) {
+	var user models.User
+	if err := first(r.db.Where("email = ? AND deleted_at IS NULL", email), &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (r *userRepository) Create(user *models.User) error {
+	query := r.db
+	if user.Birth_date == "" {
+		query = query.Omit("birth_date")
+	}
+	return query.Create(user).Error
+}
+
+func (r *userRepository) Update(id uint, fields map[string]interface{}) error {
+	return r.db.Model(&models.User{}).Where("user_id = ?", id).Updates(fields).Error
+}
+
+func (r *userRepository) ReplacePasswordHash(id uint, oldHash, newHash string) (bool, error) {
+	result := r.db.Model(&models.User{}).
+		Where("user_id = ? AND password_hash = ?", id, oldHash).
+		Update("password_hash", newHash)
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *userRepository) AddDeposit(id uint, amount uint) (uint, error) {
+	err := r.db.Model(&models.User{}).Where("user_id = ?", id).
+		UpdateColumn("deposit", gorm.Expr("deposit + ?", amount)).Error
+	if err != nil {
+		return 0, err
+	}
+
+	var user models.User
+	if err := first(r.db.Select("deposit").Where("user_id = ?", id), &user); err != nil {
+		return 0, err
+	}
+	return user.Deposit, nil
+}
@@ -0,0 +1,43 @@
+package routes_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"finalp2/auth"
+	"finalp2/controllers"
+	"finalp2/routes/routestest"
+)
+
+func createAPIKey(t *testing.T, client *routestest.Client, scopes ...string) controllers.CreatedAPIKey {
+	t.Helper()
+	var key controllers.CreatedAPIKey
+	client.Post("/users/me/api-keys", map[string]interface{}{"name": "test", "scopes": scopes}).
+		ExpectStatus(http.StatusCreated).Decode(&key)
+	return key
+}
+
+func TestAPIKeyOnlyOpensItsScopes(t *testing.T) {
+	app := routestest.New(t)
+	key := createAPIKey(t, app.Login(t, routestest.UserEmail, routestest.UserPassword), auth.ScopeCatalogRead)
+	withKey := app.Client(t).WithHeader(auth.APIKeyHeader, key.Key)
+
+	withKey.Get("/books/all").ExpectStatus(http.StatusOK)
+	withKey.Get("/users/rent-history").ExpectError(http.StatusForbidden, "API key lacks the reports:read scope")
+	// Routes that don't take API keys at all only look for a bearer token
+	withKey.Get("/users/me").ExpectError(http.StatusUnauthorized, "Missing or malformed token")
+}
+
+func TestRevokedAPIKeyIsRefused(t *testing.T) {
+	app := routestest.New(t)
+	client := app.Login(t, routestest.UserEmail, routestest.UserPassword)
+	key := createAPIKey(t, client, auth.ScopeCatalogRead)
+	withKey := app.Client(t).WithHeader(auth.APIKeyHeader, key.Key)
+	withKey.Get("/books/all").ExpectStatus(http.StatusOK)
+
+	client.Delete(fmt.Sprintf("/users/me/api-keys/%d", key.ID)).ExpectStatus(http.StatusOK)
+	withKey.Get("/books/all").ExpectError(http.StatusUnauthorized, "Invalid, expired or revoked API key")
+	app.Client(t).WithHeader(auth.APIKeyHeader, "bk_not-a-key").Get("/books/all").
+		ExpectError(http.StatusUnauthorized, "Invalid, expired or revoked API key")
+}
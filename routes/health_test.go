@@ -0,0 +1,130 @@
+package routes_test
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"finalp2/config"
+	"finalp2/controllers"
+	"finalp2/routes/routestest"
+
+	"gorm.io/gorm"
+)
+
+func TestLiveness(t *testing.T) {
+	app := routestest.New(t)
+
+	var status controllers.HealthStatus
+	app.Client(t).Get("/healthz").ExpectStatus(http.StatusOK).Decode(&status)
+	if status.Status != "ok" {
+		t.Fatalf("status = %+v", status)
+	}
+}
+
+func TestReadiness(t *testing.T) {
+	app := routestest.New(t)
+
+	var status controllers.HealthStatus
+	app.Client(t).Get("/readyz").ExpectStatus(http.StatusOK).Decode(&status)
+	if status.Status != "ok" || len(status.Checks) != 3 {
+		t.Fatalf("status = %+v", status)
+	}
+	for name, check := range status.Checks {
+		if check.Status != "ok" {
+			t.Errorf("check %s = %+v", name, check)
+		}
+	}
+}
+
+func TestReadinessOnlyReads(t *testing.T) {
+	app := routestest.New(t)
+
+	var mu sync.Mutex
+	var statements []string
+	record := func(db *gorm.DB) {
+		mu.Lock()
+		defer mu.Unlock()
+		statements = append(statements, db.Statement.SQL.String())
+	}
+	callbacks := app.DB.Callback()
+	callbacks.Query().After("gorm:query").Register("health_test:record", record)
+	callbacks.Row().After("gorm:row").Register("health_test:record", record)
+	callbacks.Raw().After("gorm:raw").Register("health_test:record", record)
+
+	app.Client(t).Get("/readyz").ExpectStatus(http.StatusOK)
+	if len(statements) == 0 {
+		t.Fatal("no statements recorded")
+	}
+	for _, statement := range statements {
+		if !strings.HasPrefix(strings.ToUpper(strings.TrimSpace(statement)), "SELECT") {
+			t.Errorf("readiness check ran %q", statement)
+		}
+	}
+}
+
+func TestReadinessFailsWhenPaymentGatewayIsDown(t *testing.T) {
+	app := routestest.New(t)
+	app.Xendit.Fail(true)
+
+	var status controllers.HealthStatus
+	app.Client(t).Get("/readyz").ExpectStatus(http.StatusServiceUnavailable).Decode(&status)
+	if status.Status != "unavailable" || status.Checks["payment_gateway"].Status != "failed" {
+		t.Fatalf("status = %+v", status)
+	}
+	if status.Checks["database"].Status != "ok" {
+		t.Fatalf("database check = %+v", status.Checks["database"])
+	}
+}
+
+func TestReadinessReusesPaymentGatewayCheck(t *testing.T) {
+	app := routestest.New(t)
+	app.Client(t).Get("/readyz").ExpectStatus(http.StatusOK)
+
+	// The gateway going down shows up with the next probe of it, not the
+	// next readiness check
+	app.Xendit.Fail(true)
+	var status controllers.HealthStatus
+	app.Client(t).Get("/readyz").ExpectStatus(http.StatusOK).Decode(&status)
+	if status.Checks["payment_gateway"].Status != "ok" {
+		t.Fatalf("payment gateway check = %+v", status.Checks["payment_gateway"])
+	}
+}
+
+func TestReadinessSkipsDefaultPaymentGateway(t *testing.T) {
+	app := routestest.New(t, func(cfg *config.Config) {
+		cfg.Xendit.APIURL = ""
+	})
+
+	var status controllers.HealthStatus
+	app.Client(t).Get("/readyz").ExpectStatus(http.StatusOK).Decode(&status)
+	if _, ok := status.Checks["payment_gateway"]; ok || len(status.Checks) != 2 {
+		t.Fatalf("checks = %+v, want only the database and migrations", status.Checks)
+	}
+}
+
+func TestReadinessFailsWithPendingMigrations(t *testing.T) {
+	app := routestest.New(t)
+	if err := app.DB.Exec("DELETE FROM schema_migrations").Error; err != nil {
+		t.Fatal(err)
+	}
+
+	var status controllers.HealthStatus
+	app.Client(t).Get("/readyz").ExpectStatus(http.StatusServiceUnavailable).Decode(&status)
+	if check := status.Checks["migrations"]; check.Status != "failed" || check.Error == "" {
+		t.Fatalf("migrations check = %+v", check)
+	}
+}
+
+func TestReadinessFailsWhileDraining(t *testing.T) {
+	app := routestest.New(t)
+	app.Health.Drain()
+
+	var status controllers.HealthStatus
+	app.Client(t).Get("/readyz").ExpectStatus(http.StatusServiceUnavailable).Decode(&status)
+	if status.Status != "shutting_down" {
+		t.Fatalf("status = %+v", status)
+	}
+	app.Client(t).Get("/healthz").ExpectStatus(http.StatusOK)
+}
@@ -0,0 +1,52 @@
+package routes_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"finalp2/config"
+	"finalp2/controllers"
+	"finalp2/routes/routestest"
+)
+
+func TestDatabaseStats(t *testing.T) {
+	app := routestest.New(t)
+	staff := app.Login(t, routestest.StaffEmail, routestest.StaffPassword)
+
+	var stats controllers.PoolStats
+	staff.Get("/metrics/database").ExpectStatus(http.StatusOK).Decode(&stats)
+	if stats.MaxOpenConnections != app.Config.Database.MaxOpenConns || stats.OpenConnections == 0 {
+		t.Fatalf("stats = %+v", stats)
+	}
+
+	client := app.Login(t, routestest.UserEmail, routestest.UserPassword)
+	client.Get("/metrics/database").ExpectError(http.StatusForbidden, "Staff access required")
+	client.Post("/users/me/api-keys", map[string]interface{}{"name": "metrics", "scopes": []string{"metrics:read"}}).
+		ExpectError(http.StatusForbidden, "The metrics:read scope requires staff access")
+}
+
+func TestDatabaseStatsWithAPIKey(t *testing.T) {
+	app := routestest.New(t)
+	staff := app.Login(t, routestest.StaffEmail, routestest.StaffPassword)
+
+	var created controllers.CreatedAPIKey
+	staff.Post("/users/me/api-keys", map[string]interface{}{"name": "monitoring", "scopes": []string{"metrics:read"}}).
+		ExpectStatus(http.StatusCreated).Decode(&created)
+
+	scraper := app.Client(t).WithHeader("X-API-Key", created.Key)
+	scraper.Get("/metrics/database").ExpectStatus(http.StatusOK)
+	scraper.Get("/users/rent-history").ExpectError(http.StatusForbidden, "API key lacks the reports:read scope")
+}
+
+func TestQueryTimeoutCancelsQueries(t *testing.T) {
+	app := routestest.New(t, func(cfg *config.Config) {
+		cfg.Database.QueryTimeout = time.Nanosecond
+	})
+
+	res := app.Client(t).Post("/users/login", map[string]string{
+		"email":    routestest.UserEmail,
+		"password": routestest.UserPassword,
+	})
+	res.ExpectError(http.StatusInternalServerError, "Failed to log in")
+}
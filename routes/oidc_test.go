@@ -0,0 +1,197 @@
+package routes_test
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"finalp2/auth"
+	"finalp2/config"
+	"finalp2/models"
+	"finalp2/oidc"
+	"finalp2/oidc/oidctest"
+	"finalp2/routes/routestest"
+)
+
+var oidcUser = oidctest.User{
+	Subject:       "oidc-subject",
+	Email:         "oidc@example.com",
+	EmailVerified: true,
+	GivenName:     "Oidc",
+}
+
+// newOIDCApp starts the app with mock as login provider "mock" and closes
+// the provider when the test ends.
+func newOIDCApp(t *testing.T, mock *oidctest.Provider) *routestest.App {
+	t.Helper()
+	t.Cleanup(mock.Close)
+	return routestest.New(t, func(cfg *config.Config) {
+		cfg.Auth.OIDCProviders = []oidc.ProviderConfig{{
+			Name:         "mock",
+			Issuer:       mock.Issuer(),
+			ClientID:     "client-id",
+			ClientSecret: "secret",
+			RedirectURL:  "http://app.test/users/oidc/mock/callback",
+		}}
+	})
+}
+
+// loginWithProvider goes through the provider login and returns its tokens.
+func loginWithProvider(t *testing.T, app *routestest.App) auth.TokenPair {
+	t.Helper()
+	start := app.Client(t).Get("/users/oidc/mock/login").ExpectStatus(http.StatusFound)
+	var state *http.Cookie
+	for _, cookie := range (&http.Response{Header: start.Header()}).Cookies() {
+		if cookie.Name == "oidc_state" {
+			state = cookie
+		}
+	}
+	if state == nil {
+		t.Fatal("login set no state cookie")
+	}
+
+	noRedirects := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	res, err := noRedirects.Get(start.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("authorize: %v", err)
+	}
+	res.Body.Close()
+	callback, err := url.Parse(res.Header.Get("Location"))
+	if err != nil {
+		t.Fatalf("callback location: %v", err)
+	}
+
+	var tokens auth.TokenPair
+	app.Client(t).WithHeader("Cookie", state.Name+"="+state.Value).
+		Get(callback.RequestURI()).ExpectStatus(http.StatusOK).Decode(&tokens)
+	return tokens
+}
+
+func bearer(t *testing.T, app *routestest.App, tokens auth.TokenPair) *routestest.Client {
+	return app.Client(t).WithHeader("Authorization", "Bearer "+tokens.AccessToken)
+}
+
+// ageLogin makes the sessions of the OIDC user look like they were signed in
+// to an hour ago and returns tokens refreshed since.
+func ageLogin(t *testing.T, app *routestest.App, tokens auth.TokenPair) auth.TokenPair {
+	t.Helper()
+	user := app.User(t, oidcUser.Email)
+	err := app.DB.Model(&models.Session{}).Where("user_id = ?", user.ID).
+		Update("created_at", time.Now().Add(-time.Hour)).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	var refreshed auth.TokenPair
+	app.Client(t).Post("/users/refresh", map[string]string{"refresh_token": tokens.RefreshToken}).
+		ExpectStatus(http.StatusOK).Decode(&refreshed)
+	return refreshed
+}
+
+// enableTwoFactor turns on two-factor authentication for the OIDC user and
+// returns their recovery codes.
+func enableTwoFactor(t *testing.T, app *routestest.App) []string {
+	t.Helper()
+	user := app.User(t, oidcUser.Email)
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = app.DB.Model(&models.User{}).Where("user_id = ?", user.ID).
+		Updates(map[string]interface{}{"totp_secret": secret, "totp_enabled_at": time.Now()}).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	codes, err := auth.GenerateRecoveryCodes(app.DB, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return codes
+}
+
+func TestOIDCLinksEmailInAnyCase(t *testing.T) {
+	mock := oidctest.NewProvider("client-id", oidctest.User{
+		Subject:       "mixed-case",
+		Email:         "User@Example.com",
+		EmailVerified: true,
+	})
+	app := newOIDCApp(t, mock)
+	loginWithProvider(t, app)
+
+	var links []models.UserIdentity
+	if err := app.DB.Find(&links).Error; err != nil {
+		t.Fatal(err)
+	}
+	user := app.User(t, routestest.UserEmail)
+	if len(links) != 1 || links[0].UserID != user.ID || links[0].Email != routestest.UserEmail {
+		t.Fatalf("identities = %+v, want one linked to user %d", links, user.ID)
+	}
+}
+
+func TestOIDCOnlyUserDeletesAccountAfterRecentLogin(t *testing.T) {
+	app := newOIDCApp(t, oidctest.NewProvider("client-id", oidcUser))
+	tokens := loginWithProvider(t, app)
+	if user := app.User(t, oidcUser.Email); user.Password != "" {
+		t.Fatal("OIDC user has a password")
+	}
+
+	bearer(t, app, tokens).Do(http.MethodDelete, "/users/me", map[string]string{}).ExpectStatus(http.StatusOK)
+
+	var user models.User
+	if err := app.DB.Where("email = ?", oidcUser.Email).Limit(1).Find(&user).Error; err != nil || user.ID != 0 {
+		t.Fatalf("user still there: %+v, %v", user, err)
+	}
+}
+
+func TestOIDCOnlyUserConfirmsOlderLoginWithCode(t *testing.T) {
+	app := newOIDCApp(t, oidctest.NewProvider("client-id", oidcUser))
+	tokens := ageLogin(t, app, loginWithProvider(t, app))
+
+	client := bearer(t, app, tokens)
+	client.Do(http.MethodDelete, "/users/me", map[string]string{}).
+		ExpectError(http.StatusBadRequest, "Please log in with your login provider again to confirm")
+
+	codes := enableTwoFactor(t, app)
+	client.Do(http.MethodDelete, "/users/me", map[string]string{}).
+		ExpectError(http.StatusBadRequest, "Please enter a two-factor code, or log in with your login provider again, to confirm")
+	client.Do(http.MethodDelete, "/users/me", map[string]string{"code": "not-a-code"}).
+		ExpectError(http.StatusBadRequest, "Invalid two-factor code")
+	client.Do(http.MethodDelete, "/users/me", map[string]string{"code": codes[0]}).ExpectStatus(http.StatusOK)
+}
+
+func TestOIDCOnlyUserDisablesTwoFactorWithCode(t *testing.T) {
+	app := newOIDCApp(t, oidctest.NewProvider("client-id", oidcUser))
+	tokens := loginWithProvider(t, app)
+	codes := enableTwoFactor(t, app)
+
+	bearer(t, app, tokens).Post("/users/me/2fa/disable", map[string]string{"code": codes[0]}).
+		ExpectStatus(http.StatusOK)
+	if user := app.User(t, oidcUser.Email); user.TOTPEnabledAt != nil {
+		t.Fatal("two-factor authentication still enabled")
+	}
+}
+
+func TestOIDCOnlyUserSetsFirstPassword(t *testing.T) {
+	app := newOIDCApp(t, oidctest.NewProvider("client-id", oidcUser))
+	tokens := loginWithProvider(t, app)
+	older := ageLogin(t, app, loginWithProvider(t, app))
+
+	bearer(t, app, older).Post("/users/me/password", map[string]string{"new_password": "first-pass1"}).
+		ExpectError(http.StatusBadRequest, "Please log in with your login provider again to confirm")
+	bearer(t, app, tokens).Post("/users/me/password", map[string]string{"new_password": "first-pass1"}).
+		ExpectStatus(http.StatusOK)
+
+	app.Login(t, oidcUser.Email, "first-pass1")
+	bearer(t, app, tokens).Post("/users/me/password", map[string]string{"new_password": "second-pass2"}).
+		ExpectError(http.StatusBadRequest, "Incorrect password")
+}
+
+func TestPasswordUserStillNeedsPasswordToDeleteAccount(t *testing.T) {
+	app := routestest.New(t)
+	client := app.Login(t, routestest.UserEmail, routestest.UserPassword)
+
+	client.Do(http.MethodDelete, "/users/me", map[string]string{}).ExpectError(http.StatusBadRequest, "Incorrect password")
+	client.Do(http.MethodDelete, "/users/me", map[string]string{"password": routestest.UserPassword}).ExpectStatus(http.StatusOK)
+}
@@ -0,0 +1,393 @@
+package routes_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"finalp2/auth"
+	"finalp2/controllers"
+	"finalp2/middlewares"
+	"finalp2/models"
+	"finalp2/routes/routestest"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+type orderCreated struct {
+	OrderID    uint                `json:"order_id"`
+	TotalPrice uint                `json:"total_price"`
+	Status     models.RentalStatus `json:"status"`
+}
+
+type paymentResult struct {
+	OrderID uint                `json:"order_id"`
+	Status  models.RentalStatus `json:"status"`
+	Invoice struct {
+		ID         string `json:"id"`
+		InvoiceURL string `json:"invoice_url"`
+	} `json:"invoice"`
+}
+
+// checkout puts the book in the client's cart and orders it.
+func checkout(t *testing.T, client *routestest.Client, bookID uint) orderCreated {
+	t.Helper()
+	client.Post("/users/rent", map[string]uint{"book_id": bookID}).ExpectStatus(http.StatusOK)
+
+	var order orderCreated
+	client.Post("/users/checkout", nil).ExpectStatus(http.StatusOK).Decode(&order)
+	return order
+}
+
+func TestCart(t *testing.T) {
+	app := routestest.New(t)
+	client := app.Login(t, routestest.UserEmail, routestest.UserPassword)
+	book := app.Book(t, "1984")
+
+	var cart []models.Book
+	client.Get("/users/carts").ExpectStatus(http.StatusOK).Decode(&cart)
+	if len(cart) != 0 {
+		t.Fatalf("new cart has %d books", len(cart))
+	}
+
+	client.Post("/users/rent", map[string]uint{"book_id": book.ID}).ExpectStatus(http.StatusOK)
+	client.Post("/users/rent", map[string]uint{"book_id": 999}).ExpectError(http.StatusBadRequest, "Book not found")
+	client.Post("/users/rent", map[string]string{}).ExpectStatus(http.StatusBadRequest)
+
+	client.Get("/users/carts").ExpectStatus(http.StatusOK).Decode(&cart)
+	if len(cart) != 1 || cart[0].Title != "1984" {
+		t.Fatalf("cart = %+v, want 1984", cart)
+	}
+
+	client.Delete("/users/carts").ExpectStatus(http.StatusOK)
+	client.Delete("/users/carts").ExpectError(http.StatusNotFound, "Cart is empty")
+}
+
+func TestCheckoutEmptyCart(t *testing.T) {
+	app := routestest.New(t)
+	client := app.Login(t, routestest.UserEmail, routestest.UserPassword)
+
+	client.Post("/users/checkout", nil).ExpectError(http.StatusBadRequest, "Cart is empty, cannot create order")
+}
+
+func TestRentPayAndReturn(t *testing.T) {
+	app := routestest.New(t)
+	client := app.Login(t, routestest.UserEmail, routestest.UserPassword)
+	book := app.Book(t, "1984")
+
+	order := checkout(t, client, book.ID)
+	if order.Status != models.RentalPendingPayment || order.TotalPrice != book.Price {
+		t.Fatalf("order = %+v", order)
+	}
+	var cart []models.Book
+	client.Get("/users/carts").ExpectStatus(http.StatusOK).Decode(&cart)
+	if len(cart) != 0 {
+		t.Fatalf("cart still has %d books after checkout", len(cart))
+	}
+
+	var paid paymentResult
+	client.Post(fmt.Sprintf("/users/pay/%d", order.OrderID), nil).ExpectStatus(http.StatusOK).Decode(&paid)
+	if paid.Status != models.RentalActive || paid.Invoice.ID == "" {
+		t.Fatalf("payment = %+v", paid)
+	}
+	if invoices := app.Xendit.Invoices(); len(invoices) != 1 || invoices[0]["amount"] != float64(book.Price) {
+		t.Fatalf("invoices = %+v", invoices)
+	}
+	client.Post(fmt.Sprintf("/users/pay/%d", order.OrderID), nil).ExpectError(http.StatusBadRequest, "Order is already paid")
+
+	var detail controllers.OrderDetail
+	client.Get(fmt.Sprintf("/users/orders/%d", order.OrderID)).ExpectStatus(http.StatusOK).Decode(&detail)
+	if len(detail.Items) != 1 || detail.Items[0].DueDate == nil || detail.Items[0].Returned {
+		t.Fatalf("order items = %+v", detail.Items)
+	}
+	if detail.InvoiceURL != paid.Invoice.InvoiceURL || len(detail.Payments) != 1 {
+		t.Fatalf("order payments = %+v, invoice %q", detail.Payments, detail.InvoiceURL)
+	}
+
+	var returned controllers.ReturnOutput
+	client.Post(fmt.Sprintf("/users/return/%d", book.ID), nil).ExpectStatus(http.StatusOK).Decode(&returned)
+	if len(returned.Returned) != 1 || returned.Returned[0].RentalStatus != models.RentalReturned {
+		t.Fatalf("returned = %+v", returned)
+	}
+	client.Post(fmt.Sprintf("/users/return/%d", book.ID), nil).ExpectError(http.StatusNotFound, "Rental detail not found")
+
+	var copies []models.BookCopy
+	if err := app.DB.Where("book_id = ? AND status = ?", book.ID, models.CopyRented).Find(&copies).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(copies) != 0 {
+		t.Fatalf("copies %+v still rented after the return", copies)
+	}
+}
+
+func TestPayErrors(t *testing.T) {
+	app := routestest.New(t)
+	staff := app.Login(t, routestest.StaffEmail, routestest.StaffPassword)
+	client := app.Login(t, routestest.UserEmail, routestest.UserPassword)
+	order := checkout(t, client, app.Book(t, "1984").ID)
+
+	client.Post("/users/pay/abc", nil).ExpectError(http.StatusBadRequest, "Invalid order ID")
+	client.Post("/users/pay/999", nil).ExpectError(http.StatusNotFound, "Order not found")
+	staff.Post(fmt.Sprintf("/users/pay/%d", order.OrderID), nil).
+		ExpectError(http.StatusUnauthorized, "You are not authorized to pay for this order")
+
+	app.Xendit.Fail(true)
+	client.Post(fmt.Sprintf("/users/pay/%d", order.OrderID), nil).
+		ExpectError(http.StatusInternalServerError, "Error while creating invoice")
+}
+
+func TestConcurrentPaymentsPayOnce(t *testing.T) {
+	app := routestest.New(t)
+	client := app.Login(t, routestest.UserEmail, routestest.UserPassword)
+	order := checkout(t, client, app.Book(t, "1984").ID)
+
+	const attempts = 5
+	statuses := make([]int, attempts)
+	var wg sync.WaitGroup
+	for i := range statuses {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			statuses[i] = client.Post(fmt.Sprintf("/users/pay/%d", order.OrderID), nil).Status()
+		}(i)
+	}
+	wg.Wait()
+
+	paid := 0
+	for _, status := range statuses {
+		switch status {
+		case http.StatusOK:
+			paid++
+		case http.StatusBadRequest, http.StatusConflict:
+		default:
+			t.Errorf("payment answered %d", status)
+		}
+	}
+	if paid != 1 {
+		t.Fatalf("%d of %d concurrent payments succeeded, statuses %v", paid, attempts, statuses)
+	}
+	if invoices := app.Xendit.Invoices(); len(invoices) != 1 {
+		t.Fatalf("%d invoices created", len(invoices))
+	}
+	var payments int64
+	app.DB.Model(&models.Payment{}).Where("rental_id = ?", order.OrderID).Count(&payments)
+	if payments != 1 {
+		t.Fatalf("%d payments recorded", payments)
+	}
+}
+
+func TestReturnErrors(t *testing.T) {
+	app := routestest.New(t)
+	client := app.Login(t, routestest.UserEmail, routestest.UserPassword)
+	book := app.Book(t, "1984")
+
+	client.Post("/users/return/abc", nil).ExpectError(http.StatusBadRequest, "Invalid book ID")
+	client.Post(fmt.Sprintf("/users/return/%d", book.ID), nil).ExpectError(http.StatusNotFound, "Rental detail not found")
+	client.Post("/users/returns", map[string]interface{}{}).ExpectError(http.StatusBadRequest, "Nothing to return")
+
+	// An unpaid order has nothing to return yet
+	order := checkout(t, client, book.ID)
+	var detail controllers.OrderDetail
+	client.Get(fmt.Sprintf("/users/orders/%d", order.OrderID)).ExpectStatus(http.StatusOK).Decode(&detail)
+	client.Post(fmt.Sprintf("/users/returns/%d", detail.Items[0].RentalDetailID), nil).
+		ExpectError(http.StatusBadRequest, fmt.Sprintf("Books cannot be returned for rental %d with status pending_payment", order.OrderID))
+}
+
+func TestCounterReturn(t *testing.T) {
+	app := routestest.New(t)
+	staff := app.Login(t, routestest.StaffEmail, routestest.StaffPassword)
+	client := app.Login(t, routestest.UserEmail, routestest.UserPassword)
+	order := checkout(t, client, app.Book(t, "1984").ID)
+	client.Post(fmt.Sprintf("/users/pay/%d", order.OrderID), nil).ExpectStatus(http.StatusOK)
+
+	// The first registered copy is handed out
+	body := map[string]interface{}{"barcodes": []string{"BC-TEST-0001"}}
+	client.Post("/staff/returns", body).ExpectError(http.StatusForbidden, "Staff access required")
+
+	var returned controllers.ReturnOutput
+	staff.Post("/staff/returns", body).ExpectStatus(http.StatusOK).Decode(&returned)
+	if len(returned.Returned) != 1 || returned.Returned[0].RentalID != order.OrderID {
+		t.Fatalf("returned = %+v", returned)
+	}
+	staff.Post("/staff/returns", body).ExpectError(http.StatusNotFound, "No outstanding rental found for copy BC-TEST-0001")
+}
+
+func TestRentHistory(t *testing.T) {
+	app := routestest.New(t)
+	client := app.Login(t, routestest.UserEmail, routestest.UserPassword)
+	book := app.Book(t, "1984")
+
+	first := checkout(t, client, book.ID)
+	client.Post(fmt.Sprintf("/users/pay/%d", first.OrderID), nil).ExpectStatus(http.StatusOK)
+	second := checkout(t, client, book.ID)
+
+	var history []controllers.OutOrder
+	res := client.Get("/users/rent-history").ExpectStatus(http.StatusOK)
+	res.Decode(&history)
+	if len(history) != 2 || history[0].OrderID != second.OrderID || history[1].OrderID != first.OrderID {
+		t.Fatalf("history = %+v, want newest first", history)
+	}
+	if total := res.Header().Get("X-Total-Count"); total != "2" {
+		t.Fatalf("X-Total-Count = %q, want 2", total)
+	}
+
+	client.Get("/users/rent-history?status=active").ExpectStatus(http.StatusOK).Decode(&history)
+	if len(history) != 1 || history[0].OrderID != first.OrderID {
+		t.Fatalf("active history = %+v", history)
+	}
+
+	client.Get("/users/rent-history?limit=1&page=2").ExpectStatus(http.StatusOK).Decode(&history)
+	if len(history) != 1 || history[0].OrderID != first.OrderID {
+		t.Fatalf("second page = %+v", history)
+	}
+
+	client.Get("/users/rent-history?status=lost").ExpectError(http.StatusBadRequest, `Unknown rental status "lost"`)
+	client.Get("/users/rent-history?from=yesterday").ExpectError(http.StatusBadRequest, "Invalid from date, expected YYYY-MM-DD")
+	client.Get("/users/rent-history?limit=0").ExpectError(http.StatusBadRequest, "limit must be between 1 and 100")
+}
+
+func TestRentHistoryQueryCountIsConstant(t *testing.T) {
+	app := routestest.New(t)
+	client := app.Login(t, routestest.UserEmail, routestest.UserPassword)
+	book := app.Book(t, "1984")
+
+	var queries atomic.Int64
+	count := func(*gorm.DB) { queries.Add(1) }
+	callbacks := app.DB.Callback()
+	callbacks.Query().Register("routes_test:count", count)
+	callbacks.Row().Register("routes_test:count", count)
+	callbacks.Raw().Register("routes_test:count", count)
+	historyQueries := func(want int) int64 {
+		t.Helper()
+		queries.Store(0)
+		var history []controllers.OutOrder
+		client.Get("/users/rent-history").ExpectStatus(http.StatusOK).Decode(&history)
+		if len(history) != want {
+			t.Fatalf("history has %d rentals, want %d", len(history), want)
+		}
+		return queries.Load()
+	}
+
+	first := checkout(t, client, book.ID)
+	client.Post(fmt.Sprintf("/users/pay/%d", first.OrderID), nil).ExpectStatus(http.StatusOK)
+	one := historyQueries(1)
+	if one == 0 {
+		t.Fatal("no queries counted")
+	}
+
+	const rentals = 6
+	for i := 1; i < rentals; i++ {
+		checkout(t, client, book.ID)
+	}
+	if many := historyQueries(rentals); many != one {
+		t.Fatalf("rent history ran %d queries for %d rentals but %d for one", many, rentals, one)
+	}
+}
+
+func TestOrderVisibleToOwnerAndStaffOnly(t *testing.T) {
+	app := routestest.New(t)
+	client := app.Login(t, routestest.UserEmail, routestest.UserPassword)
+	staff := app.Login(t, routestest.StaffEmail, routestest.StaffPassword)
+	order := checkout(t, client, app.Book(t, "1984").ID)
+
+	path := fmt.Sprintf("/users/orders/%d", order.OrderID)
+	staff.Get(path).ExpectStatus(http.StatusOK)
+
+	client.Post("/users/register", map[string]string{
+		"email":      "other@example.com",
+		"password":   "s3cretpass",
+		"first_name": "Otto",
+		"birth_date": "1995-05-05",
+	}).ExpectStatus(http.StatusOK)
+	other := app.Login(t, "other@example.com", "s3cretpass")
+	other.Get(path).ExpectStatus(http.StatusForbidden)
+	other.Get("/users/orders/999").ExpectError(http.StatusNotFound, "Order not found")
+}
+
+func TestIdempotentCheckout(t *testing.T) {
+	app := routestest.New(t)
+	client := app.Login(t, routestest.UserEmail, routestest.UserPassword)
+	client.Post("/users/rent", map[string]uint{"book_id": app.Book(t, "1984").ID}).ExpectStatus(http.StatusOK)
+
+	retrying := client.WithHeader("Idempotency-Key", "checkout-1")
+	var first, replayed orderCreated
+	retrying.Post("/users/checkout", nil).ExpectStatus(http.StatusOK).Decode(&first)
+	res := retrying.Post("/users/checkout", nil).ExpectStatus(http.StatusOK)
+	res.Decode(&replayed)
+	if replayed.OrderID != first.OrderID || res.Header().Get("Idempotent-Replayed") != "true" {
+		t.Fatalf("retry created order %d, first was %d", replayed.OrderID, first.OrderID)
+	}
+
+	// Without the key the empty cart is checked again
+	client.Post("/users/checkout", nil).ExpectError(http.StatusBadRequest, "Cart is empty, cannot create order")
+}
+
+func TestIdempotencyKeyOfUnfinishedRequestTimesOut(t *testing.T) {
+	app := routestest.New(t)
+	client := app.Login(t, routestest.UserEmail, routestest.UserPassword)
+	client.Post("/users/rent", map[string]uint{"book_id": app.Book(t, "1984").ID}).ExpectStatus(http.StatusOK)
+
+	// What a request that crashed before it finished leaves behind
+	hash := sha256.Sum256([]byte("POST /users/checkout\n"))
+	unfinished := models.IdempotencyKey{
+		UserID:      app.User(t, routestest.UserEmail).ID,
+		Key:         "checkout-1",
+		Method:      http.MethodPost,
+		Path:        "/users/checkout",
+		RequestHash: hex.EncodeToString(hash[:]),
+		CreatedAt:   time.Now(),
+	}
+	if err := app.DB.Create(&unfinished).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	retrying := client.WithHeader("Idempotency-Key", "checkout-1")
+	retrying.Post("/users/checkout", nil).
+		ExpectError(http.StatusConflict, "A request with this Idempotency-Key is still being processed")
+
+	stale := time.Now().Add(-app.Config.Database.QueryTimeout - time.Second)
+	if err := app.DB.Model(&unfinished).Update("created_at", stale).Error; err != nil {
+		t.Fatal(err)
+	}
+	retrying.Post("/users/checkout", nil).ExpectStatus(http.StatusOK)
+	if res := retrying.Post("/users/checkout", nil).ExpectStatus(http.StatusOK); res.Header().Get("Idempotent-Replayed") != "true" {
+		t.Fatal("the retry after the stale key was not replayed")
+	}
+}
+
+func TestIdempotencyKeyIsFreedWhenHandlerPanics(t *testing.T) {
+	app := routestest.New(t)
+	user := app.User(t, routestest.UserEmail)
+	signedIn := func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			auth.SetCurrentUser(c, &user, &auth.Claims{})
+			return next(c)
+		}
+	}
+	panicking := true
+	app.Echo.POST("/flaky", func(c echo.Context) error {
+		if panicking {
+			panic("handler crashed")
+		}
+		return c.NoContent(http.StatusNoContent)
+	}, signedIn, middlewares.Idempotency(app.DB, time.Hour))
+
+	retrying := app.Client(t).WithHeader("Idempotency-Key", "flaky-1")
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("handler did not panic")
+			}
+		}()
+		retrying.Post("/flaky", nil)
+	}()
+
+	panicking = false
+	retrying.Post("/flaky", nil).ExpectStatus(http.StatusNoContent)
+}
@@ -1,44 +1,125 @@
 package routes
 
 import (
+	"finalp2/auth"
+	"finalp2/config"
 	"finalp2/controllers"
+	"finalp2/helper"
+	"finalp2/mailer"
+	"finalp2/middlewares"
+	"finalp2/oidc"
+	"finalp2/repository"
+	"finalp2/services"
+	"finalp2/utils"
 	"github.com/labstack/echo/v4"
-	"github.com/labstack/echo/v4/middleware"
-	"github.com/golang-jwt/jwt"
 	"gorm.io/gorm"
+	"net"
 
 	_ "finalp2/docs"
-    echoSwagger "github.com/swaggo/echo-swagger"
+	echoSwagger "github.com/swaggo/echo-swagger"
 )
 
-func SetupRoutes(e *echo.Echo, db *gorm.DB) {
-	// Insert db to echo context
-	e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
-		return func(c echo.Context) error {
-			c.Set("db", db)
-			return next(c)
-		}
-	})
+// SetupRoutes registers the API's routes. It returns the health handler so
+// the server can report that it is not ready while it shuts down.
+func SetupRoutes(e *echo.Echo, db *gorm.DB, cfg *config.Config, keys *auth.KeyManager, mail mailer.Mailer, loginLimiter *auth.LoginLimiter, oidcProviders *oidc.Registry, passwordHasher *auth.PasswordHasher) *controllers.HealthHandler {
+	e.Validator = utils.NewValidator()
+	// The ranges were checked when loading the config
+	proxies, _ := cfg.Server.TrustedProxyRanges()
+	e.IPExtractor = ipExtractor(proxies)
+	e.Use(middlewares.QueryTimeout(cfg.Database.QueryTimeout))
+
+	store := repository.NewStore(db)
+	rentalService := services.NewRentalService(store)
+	paymentService := services.NewPaymentService(store, helper.XenditInvoicer{Config: cfg.Xendit})
+
+	books := controllers.NewBookHandler(services.NewBookService(store))
+	carts := controllers.NewCartHandler(services.NewCartService(store))
+	rentals := controllers.NewRentalHandler(rentalService)
+	payments := controllers.NewPaymentHandler(paymentService)
+	users := controllers.NewUserHandler(store, services.NewUserService(store), rentalService, cfg, keys, mail, loginLimiter, oidcProviders, passwordHasher)
+	monitoring := controllers.NewMonitoringHandler(db)
+	health := controllers.NewHealthHandler(db, cfg.Xendit)
 
 	// Without jwt tokens
 	e.GET("/swagger/*", echoSwagger.WrapHandler)
-	e.POST("/users/register", controllers.RegisterUser)
-	e.POST("/users/login", controllers.LoginUser)
+	e.GET("/healthz", health.Liveness)
+	e.GET("/readyz", health.Readiness)
+	e.GET("/.well-known/jwks.json", users.JWKS)
+	e.POST("/users/register", users.RegisterUser)
+	e.POST("/users/login", users.LoginUser)
+	e.POST("/users/login/2fa", users.LoginTwoFactor)
+	e.GET("/users/oidc/providers", users.ListOIDCProviders)
+	e.GET("/users/oidc/:provider/login", users.OIDCLogin)
+	e.GET("/users/oidc/:provider/callback", users.OIDCCallback)
+	e.POST("/users/refresh", users.RefreshToken)
+	e.POST("/users/verify-email/confirm", users.VerifyEmail)
+	e.POST("/users/password/forgot", users.ForgotPassword)
+	e.POST("/users/password/reset", users.ResetPassword)
 
 	// With jwt tokens
-	jwtMiddleware := middleware.JWTWithConfig(middleware.JWTConfig{
-		SigningKey: []byte("secret"),
-		Claims:     jwt.MapClaims{},
-	})
-
-	e.GET("/books/all", controllers.GetAllBooks, jwtMiddleware)
-	e.GET("/books/:id", controllers.GetBookById, jwtMiddleware)
-	e.POST("/users/topup", controllers.Topup, jwtMiddleware)
-	e.POST("/users/rent", controllers.AddCart, jwtMiddleware)
-	e.GET("/users/carts", controllers.GetCart, jwtMiddleware)
-	e.DELETE("/users/carts", controllers.DeleteCart, jwtMiddleware)
-	e.POST("/users/checkout", controllers.AddOrder, jwtMiddleware)
-	e.POST("/users/pay/:order_id", controllers.Pay, jwtMiddleware)
-	e.POST("/users/return/:id", controllers.Return, jwtMiddleware)
-	e.GET("/users/rent-history", controllers.GetRent, jwtMiddleware)
+	jwtMiddleware := middlewares.JWTAuth(db, keys)
+
+	e.POST("/users/logout", users.Logout, jwtMiddleware)
+	e.POST("/users/verify-email/request", users.RequestEmailVerification, jwtMiddleware)
+	e.GET("/users/me", users.GetProfile, jwtMiddleware)
+	e.PATCH("/users/me", users.UpdateProfile, jwtMiddleware)
+	e.DELETE("/users/me", users.DeleteAccount, jwtMiddleware)
+	e.POST("/users/me/password", users.ChangePassword, jwtMiddleware)
+	e.POST("/users/me/2fa/enroll", users.EnrollTwoFactor, jwtMiddleware)
+	e.POST("/users/me/2fa/confirm", users.ConfirmTwoFactor, jwtMiddleware)
+	e.POST("/users/me/2fa/disable", users.DisableTwoFactor, jwtMiddleware)
+	e.POST("/users/me/2fa/recovery-codes", users.RegenerateRecoveryCodes, jwtMiddleware)
+	e.GET("/users/me/api-keys", users.ListAPIKeys, jwtMiddleware)
+	e.POST("/users/me/api-keys", users.CreateAPIKey, jwtMiddleware)
+	e.DELETE("/users/me/api-keys/:id", users.RevokeAPIKey, jwtMiddleware)
+
+	// Also open to API keys with the matching scope
+	catalogRead := middlewares.JWTOrAPIKey(db, keys, auth.ScopeCatalogRead)
+	reportsRead := middlewares.JWTOrAPIKey(db, keys, auth.ScopeReportsRead)
+	inventoryManage := middlewares.JWTOrAPIKey(db, keys, auth.ScopeInventoryManage)
+	metricsRead := middlewares.JWTOrAPIKey(db, keys, auth.ScopeMetricsRead)
+
+	// Mutating endpoints accept an Idempotency-Key header so clients can retry safely
+	idempotent := middlewares.Idempotency(db, cfg.Database.QueryTimeout)
+
+	e.GET("/books/all", books.GetAllBooks, catalogRead)
+	e.GET("/books/:id", books.GetBookById, catalogRead)
+	e.POST("/users/topup", payments.Topup, jwtMiddleware, idempotent)
+	e.POST("/users/rent", carts.AddCart, jwtMiddleware, idempotent)
+	e.GET("/users/carts", carts.GetCart, jwtMiddleware)
+	e.DELETE("/users/carts", carts.DeleteCart, jwtMiddleware, idempotent)
+	e.POST("/users/checkout", rentals.AddOrder, jwtMiddleware, idempotent)
+	e.POST("/users/pay/:order_id", payments.Pay, jwtMiddleware, idempotent)
+	e.POST("/users/return/:id", rentals.Return, jwtMiddleware, idempotent)
+	e.POST("/users/returns", rentals.ReturnBatch, jwtMiddleware, idempotent)
+	e.POST("/users/returns/:rental_detail_id", rentals.ReturnRentalDetail, jwtMiddleware, idempotent)
+	e.GET("/users/rent-history", rentals.GetRent, reportsRead)
+	e.GET("/users/orders/:order_id", rentals.GetOrder, reportsRead)
+
+	// Staff only
+	e.GET("/metrics/database", monitoring.DatabaseStats, metricsRead, middlewares.RequireStaff)
+	staff := e.Group("/staff", inventoryManage, middlewares.RequireStaff)
+	staff.POST("/returns", rentals.CounterReturn, idempotent)
+
+	// Admin only
+	admin := e.Group("/admin", jwtMiddleware, middlewares.RequireAdmin)
+	admin.POST("/users/:id/unlock", users.UnlockUser)
+	admin.GET("/users/:id/api-keys", users.ListUserAPIKeys)
+	admin.DELETE("/users/:id/api-keys/:key_id", users.RevokeUserAPIKey)
+
+	return health
+}
+
+// ipExtractor only believes X-Forwarded-For on requests that came through one
+// of the trusted proxies, so clients can't choose the IP address the login
+// throttle counts their attempts under.
+func ipExtractor(proxies []*net.IPNet) echo.IPExtractor {
+	if len(proxies) == 0 {
+		return echo.ExtractIPDirect()
+	}
+	options := []echo.TrustOption{echo.TrustLoopback(false), echo.TrustLinkLocal(false), echo.TrustPrivateNet(false)}
+	for _, proxy := range proxies {
+		options = append(options, echo.TrustIPRange(proxy))
+	}
+	return echo.ExtractIPFromXFFHeader(options...)
 }
@@ -0,0 +1,357 @@
+// Package routestest runs the whole API from routes.SetupRoutes against a
+// throwaway, fully migrated SQLite database, for HTTP-level tests.
+package routestest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"finalp2/auth"
+	"finalp2/config"
+	"finalp2/controllers"
+	"finalp2/helper"
+	"finalp2/mailer"
+	"finalp2/migrations"
+	"finalp2/models"
+	"finalp2/oidc"
+	"finalp2/routes"
+	"finalp2/seeds"
+	"finalp2/utils"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// Seeded accounts of the test fixtures.
+const (
+	UserEmail     = "user@example.com"
+	UserPassword  = "password1"
+	StaffEmail    = "staff@example.com"
+	StaffPassword = "staff12345"
+)
+
+// App is a running instance of the API.
+type App struct {
+	Echo    *echo.Echo
+	DB      *gorm.DB
+	Config  *config.Config
+	Mailer  *mailer.MemoryMailer
+	Xendit  *Xendit
+	Health  *controllers.HealthHandler
+	Limiter *auth.LoginLimiter
+}
+
+// New starts the API on a fresh database loaded with the test fixtures. It
+// is torn down when the test ends. The configure functions may change the
+// configuration before anything is set up.
+func New(t testing.TB, configure ...func(cfg *config.Config)) *App {
+	t.Helper()
+
+	xendit := NewXendit()
+	t.Cleanup(xendit.Close)
+
+	cfg := config.Default()
+	cfg.Server.Environment = "test"
+	cfg.Database.Driver = "sqlite"
+	cfg.Database.Path = filepath.Join(t.TempDir(), "test.db")
+	cfg.JWT.Secret = "routestest-secret-of-at-least-32-bytes"
+	cfg.Auth.LoginAttemptStore = "memory"
+	cfg.Password.BcryptCost = 4
+	cfg.Mail.Driver = "memory"
+	cfg.Xendit.APIKey = "routestest"
+	cfg.Xendit.APIURL = xendit.URL()
+	for _, fn := range configure {
+		fn(&cfg)
+	}
+
+	db, err := config.InitDB(cfg.Database)
+	if err != nil {
+		t.Fatalf("opening test database: %v", err)
+	}
+	db.Logger = logger.Discard
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	migrator, err := migrations.New(db)
+	if err != nil {
+		t.Fatalf("loading migrations: %v", err)
+	}
+	if _, err := migrator.Up(); err != nil {
+		t.Fatalf("migrating: %v", err)
+	}
+
+	hasher, err := cfg.Password.Hasher()
+	if err != nil {
+		t.Fatalf("password hasher: %v", err)
+	}
+	fixtures, err := seeds.Load(cfg.Server.Environment)
+	if err != nil {
+		t.Fatalf("loading fixtures: %v", err)
+	}
+	if _, err := seeds.Seed(db, hasher, fixtures); err != nil {
+		t.Fatalf("seeding: %v", err)
+	}
+
+	keys, err := auth.NewKeyManager(cfg.JWT.KeyConfigs(), cfg.JWT.ActiveKID)
+	if err != nil {
+		t.Fatalf("JWT keys: %v", err)
+	}
+	attempts, err := auth.NewAttemptStore(db, cfg.Auth.LoginAttemptStore)
+	if err != nil {
+		t.Fatalf("login attempt store: %v", err)
+	}
+	providers, err := oidc.NewRegistry(cfg.Auth.OIDCProviders)
+	if err != nil {
+		t.Fatalf("OIDC providers: %v", err)
+	}
+	mail := mailer.NewMemoryMailer()
+	limiter := auth.NewLoginLimiter(attempts)
+
+	e := echo.New()
+	e.HideBanner = true
+	health := routes.SetupRoutes(e, db, &cfg, keys, mail, limiter, providers, hasher)
+
+	return &App{Echo: e, DB: db, Config: &cfg, Mailer: mail, Xendit: xendit, Health: health, Limiter: limiter}
+}
+
+// User returns the seeded user with the email.
+func (a *App) User(t testing.TB, email string) models.User {
+	t.Helper()
+	var user models.User
+	if err := a.DB.Where("email = ?", email).First(&user).Error; err != nil {
+		t.Fatalf("loading user %s: %v", email, err)
+	}
+	return user
+}
+
+// Book returns the seeded book with the title.
+func (a *App) Book(t testing.TB, title string) models.Book {
+	t.Helper()
+	var book models.Book
+	if err := a.DB.Where("title = ?", title).First(&book).Error; err != nil {
+		t.Fatalf("loading book %q: %v", title, err)
+	}
+	return book
+}
+
+// Client returns a client without credentials.
+func (a *App) Client(t testing.TB) *Client {
+	return &Client{t: t, app: a, header: http.Header{}}
+}
+
+// Login logs in with the credentials and returns a client that sends the
+// access token with every request.
+func (a *App) Login(t testing.TB, email, password string) *Client {
+	t.Helper()
+	res := a.Client(t).Post("/users/login", map[string]string{"email": email, "password": password})
+	res.ExpectStatus(http.StatusOK)
+
+	var tokens auth.TokenPair
+	res.Decode(&tokens)
+	client := a.Client(t)
+	client.header.Set(echo.HeaderAuthorization, "Bearer "+tokens.AccessToken)
+	return client
+}
+
+// LoginAdmin makes the seeded staff member an admin with two-factor
+// authentication and logs in with both factors, as admin routes require.
+func (a *App) LoginAdmin(t testing.TB) *Client {
+	t.Helper()
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = a.DB.Model(&models.User{}).Where("email = ?", StaffEmail).Updates(map[string]interface{}{
+		"role":            models.RoleAdmin,
+		"totp_secret":     secret,
+		"totp_enabled_at": time.Now(),
+	}).Error
+	if err != nil {
+		t.Fatalf("making %s an admin: %v", StaffEmail, err)
+	}
+
+	var challenge controllers.TwoFactorChallenge
+	a.Client(t).Post("/users/login", map[string]string{"email": StaffEmail, "password": StaffPassword}).
+		ExpectStatus(http.StatusOK).Decode(&challenge)
+	var tokens auth.TokenPair
+	a.Client(t).Post("/users/login/2fa", map[string]string{"challenge_token": challenge.ChallengeToken, "code": TOTPCode(secret, time.Now())}).
+		ExpectStatus(http.StatusOK).Decode(&tokens)
+	return a.Client(t).WithHeader(echo.HeaderAuthorization, "Bearer "+tokens.AccessToken)
+}
+
+// Client sends requests to the app in process.
+type Client struct {
+	t      testing.TB
+	app    *App
+	header http.Header
+}
+
+// WithHeader returns a copy of the client that also sends the header.
+func (c *Client) WithHeader(key, value string) *Client {
+	header := c.header.Clone()
+	header.Set(key, value)
+	return &Client{t: c.t, app: c.app, header: header}
+}
+
+func (c *Client) Get(path string) *Response {
+	return c.Do(http.MethodGet, path, nil)
+}
+
+func (c *Client) Post(path string, body interface{}) *Response {
+	return c.Do(http.MethodPost, path, body)
+}
+
+func (c *Client) Patch(path string, body interface{}) *Response {
+	return c.Do(http.MethodPatch, path, body)
+}
+
+func (c *Client) Delete(path string) *Response {
+	return c.Do(http.MethodDelete, path, nil)
+}
+
+// Do sends the request, encoding body as JSON when it is not nil.
+func (c *Client) Do(method, path string, body interface{}) *Response {
+	c.t.Helper()
+	var reader *bytes.Reader
+	if body == nil {
+		reader = bytes.NewReader(nil)
+	} else {
+		raw, err := json.Marshal(body)
+		if err != nil {
+			c.t.Fatalf("encoding request body: %v", err)
+		}
+		reader = bytes.NewReader(raw)
+	}
+
+	req := httptest.NewRequest(method, path, reader)
+	for key, values := range c.header {
+		req.Header[key] = values
+	}
+	if body != nil {
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	}
+
+	rec := httptest.NewRecorder()
+	c.app.Echo.ServeHTTP(rec, req)
+	return &Response{t: c.t, Request: req, Recorder: rec}
+}
+
+// Response is the recorded response to a request.
+type Response struct {
+	t        testing.TB
+	Request  *http.Request
+	Recorder *httptest.ResponseRecorder
+}
+
+func (r *Response) Status() int {
+	return r.Recorder.Code
+}
+
+func (r *Response) Header() http.Header {
+	return r.Recorder.Header()
+}
+
+func (r *Response) Body() string {
+	return r.Recorder.Body.String()
+}
+
+// ExpectStatus fails the test unless the response has the status.
+func (r *Response) ExpectStatus(status int) *Response {
+	r.t.Helper()
+	if r.Status() != status {
+		r.t.Fatalf("%s %s: status = %d, want %d; body: %s", r.Request.Method, r.Request.URL, r.Status(), status, r.Body())
+	}
+	return r
+}
+
+// Decode decodes the JSON body into v.
+func (r *Response) Decode(v interface{}) {
+	r.t.Helper()
+	if err := json.Unmarshal(r.Recorder.Body.Bytes(), v); err != nil {
+		r.t.Fatalf("%s %s: decoding body %q: %v", r.Request.Method, r.Request.URL, r.Body(), err)
+	}
+}
+
+// ExpectError fails the test unless the response is an API error with the
+// status and message.
+func (r *Response) ExpectError(status int, message string) *utils.APIError {
+	r.t.Helper()
+	r.ExpectStatus(status)
+	var apiErr utils.APIError
+	r.Decode(&apiErr)
+	if apiErr.Message != message {
+		r.t.Fatalf("%s %s: error message = %q, want %q", r.Request.Method, r.Request.URL, apiErr.Message, message)
+	}
+	return &apiErr
+}
+
+// Xendit is a fake of the Xendit invoice API.
+type Xendit struct {
+	server *httptest.Server
+
+	mu       sync.Mutex
+	invoices []map[string]interface{}
+	fail     bool
+}
+
+func NewXendit() *Xendit {
+	x := &Xendit{}
+	x.server = httptest.NewServer(http.HandlerFunc(x.serveHTTP))
+	return x
+}
+
+func (x *Xendit) URL() string {
+	return x.server.URL
+}
+
+func (x *Xendit) Close() {
+	x.server.Close()
+}
+
+// Fail makes the API answer every request with a server error.
+func (x *Xendit) Fail(fail bool) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.fail = fail
+}
+
+// Invoices returns the request bodies of the invoices created so far.
+func (x *Xendit) Invoices() []map[string]interface{} {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	return append([]map[string]interface{}{}, x.invoices...)
+}
+
+func (x *Xendit) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if x.fail {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	if r.Method != http.MethodPost || r.URL.Path != "/v2/invoices" {
+		http.NotFound(w, r)
+		return
+	}
+
+	var body map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	x.invoices = append(x.invoices, body)
+
+	id := fmt.Sprintf("inv-%d", len(x.invoices))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(helper.Invoice{ID: id, InvoiceUrl: "https://checkout.xendit.test/" + id})
+}
@@ -0,0 +1,57 @@
+package routes_test
+
+import (
+	"net/http"
+	"testing"
+
+	"finalp2/auth"
+	"finalp2/routes/routestest"
+)
+
+func login(t *testing.T, app *routestest.App) auth.TokenPair {
+	t.Helper()
+	var tokens auth.TokenPair
+	app.Client(t).Post("/users/login", map[string]string{"email": routestest.UserEmail, "password": routestest.UserPassword}).
+		ExpectStatus(http.StatusOK).Decode(&tokens)
+	return tokens
+}
+
+func refresh(t *testing.T, app *routestest.App, refreshToken string) *routestest.Response {
+	return app.Client(t).Post("/users/refresh", map[string]string{"refresh_token": refreshToken})
+}
+
+func TestRefreshRotatesTokens(t *testing.T) {
+	app := routestest.New(t)
+	first := login(t, app)
+
+	var second auth.TokenPair
+	refresh(t, app, first.RefreshToken).ExpectStatus(http.StatusOK).Decode(&second)
+	if second.RefreshToken == first.RefreshToken || second.AccessToken == first.AccessToken {
+		t.Fatal("refresh returned the same tokens")
+	}
+	bearer(t, app, second).Get("/users/me").ExpectStatus(http.StatusOK)
+	refresh(t, app, second.RefreshToken).ExpectStatus(http.StatusOK)
+}
+
+func TestReusedRefreshTokenRevokesSession(t *testing.T) {
+	app := routestest.New(t)
+	first := login(t, app)
+	other := login(t, app)
+
+	var second auth.TokenPair
+	refresh(t, app, first.RefreshToken).ExpectStatus(http.StatusOK).Decode(&second)
+
+	// Someone replays the used token: the whole session ends
+	refresh(t, app, first.RefreshToken).ExpectError(http.StatusUnauthorized, "Refresh token was already used, please log in again")
+	refresh(t, app, second.RefreshToken).ExpectError(http.StatusUnauthorized, "Session has been revoked, please log in again")
+	bearer(t, app, second).Get("/users/me").ExpectError(http.StatusUnauthorized, "Token has been revoked")
+
+	// Other sessions of the user are left alone
+	bearer(t, app, other).Get("/users/me").ExpectStatus(http.StatusOK)
+	refresh(t, app, other.RefreshToken).ExpectStatus(http.StatusOK)
+}
+
+func TestRefreshRejectsUnknownTokens(t *testing.T) {
+	app := routestest.New(t)
+	refresh(t, app, "not-a-refresh-token").ExpectError(http.StatusUnauthorized, "Invalid or expired refresh token")
+}
@@ -0,0 +1,77 @@
+package routes_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"finalp2/controllers"
+	"finalp2/routes/routestest"
+)
+
+// enrolTwoFactor turns on two-factor authentication for the seeded user and
+// returns the TOTP secret, the code that confirmed it and the recovery codes.
+func enrolTwoFactor(t *testing.T, app *routestest.App) (secret, confirmCode string, recovery []string) {
+	t.Helper()
+	client := app.Login(t, routestest.UserEmail, routestest.UserPassword)
+
+	var enrollment controllers.TwoFactorEnrollment
+	client.Post("/users/me/2fa/enroll", nil).ExpectStatus(http.StatusOK).Decode(&enrollment)
+	confirmCode = routestest.TOTPCode(enrollment.Secret, time.Now())
+	var codes controllers.RecoveryCodes
+	client.Post("/users/me/2fa/confirm", map[string]string{"code": confirmCode}).ExpectStatus(http.StatusOK).Decode(&codes)
+	if len(codes.RecoveryCodes) != 10 {
+		t.Fatalf("got %d recovery codes, want 10", len(codes.RecoveryCodes))
+	}
+	return enrollment.Secret, confirmCode, codes.RecoveryCodes
+}
+
+// challenge logs in with the password and returns the two-factor challenge.
+func challenge(t *testing.T, app *routestest.App) string {
+	t.Helper()
+	var res controllers.TwoFactorChallenge
+	app.Client(t).Post("/users/login", map[string]string{"email": routestest.UserEmail, "password": routestest.UserPassword}).
+		ExpectStatus(http.StatusOK).Decode(&res)
+	if !res.TwoFactorRequired || res.ChallengeToken == "" {
+		t.Fatalf("login = %+v, want a two-factor challenge", res)
+	}
+	return res.ChallengeToken
+}
+
+func loginTwoFactor(t *testing.T, app *routestest.App, challenge, code string) *routestest.Response {
+	return app.Client(t).Post("/users/login/2fa", map[string]string{"challenge_token": challenge, "code": code})
+}
+
+func TestTwoFactorLoginRejectsReusedCodes(t *testing.T) {
+	app := routestest.New(t)
+	secret, confirmCode, _ := enrolTwoFactor(t, app)
+
+	token := challenge(t, app)
+	// The code that confirmed the enrolment was used up by it
+	loginTwoFactor(t, app, token, confirmCode).ExpectError(http.StatusUnauthorized, "Invalid two-factor code")
+	loginTwoFactor(t, app, token, "000000x").ExpectError(http.StatusUnauthorized, "Invalid two-factor code")
+
+	// The next code works, within the allowed clock drift
+	next := routestest.TOTPCode(secret, time.Now().Add(30*time.Second))
+	loginTwoFactor(t, app, token, next).ExpectStatus(http.StatusOK)
+	// The challenge is single-use, and so is the code
+	loginTwoFactor(t, app, token, next).ExpectError(http.StatusUnauthorized, "Invalid or expired challenge, please log in again")
+	loginTwoFactor(t, app, challenge(t, app), next).ExpectError(http.StatusUnauthorized, "Invalid two-factor code")
+}
+
+func TestTwoFactorLoginWithRecoveryCode(t *testing.T) {
+	app := routestest.New(t)
+	_, _, recovery := enrolTwoFactor(t, app)
+
+	loginTwoFactor(t, app, challenge(t, app), recovery[0]).ExpectStatus(http.StatusOK)
+	loginTwoFactor(t, app, challenge(t, app), recovery[0]).ExpectError(http.StatusUnauthorized, "Invalid two-factor code")
+	loginTwoFactor(t, app, challenge(t, app), recovery[1]).ExpectStatus(http.StatusOK)
+}
+
+func TestTwoFactorChallengeIsNotAnAccessToken(t *testing.T) {
+	app := routestest.New(t)
+	enrolTwoFactor(t, app)
+
+	app.Client(t).WithHeader("Authorization", "Bearer "+challenge(t, app)).Get("/users/me").
+		ExpectError(http.StatusUnauthorized, "Invalid or expired token")
+}
@@ -0,0 +1,255 @@
+package routes_test
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"finalp2/auth"
+	"finalp2/config"
+	"finalp2/controllers"
+	"finalp2/routes/routestest"
+	"finalp2/utils"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestRegisterAndLogin(t *testing.T) {
+	app := routestest.New(t)
+
+	res := app.Client(t).Post("/users/register", map[string]string{
+		"email":      "new@example.com",
+		"password":   "s3cretpass",
+		"first_name": "Nina",
+		"last_name":  "New",
+		"birth_date": "1995-05-05",
+		"contact_no": "0812 3456 7890",
+	}).ExpectStatus(http.StatusOK)
+
+	var created controllers.UserOutput
+	res.Decode(&created)
+	if created.ID == 0 || created.Email != "new@example.com" || created.FullName != "Nina New" {
+		t.Fatalf("created user = %+v", created)
+	}
+	if _, ok := app.Mailer.Last("new@example.com"); !ok {
+		t.Error("no verification email sent")
+	}
+
+	client := app.Login(t, "new@example.com", "s3cretpass")
+	var profile controllers.ProfileOutput
+	client.Get("/users/me").ExpectStatus(http.StatusOK).Decode(&profile)
+	if profile.ID != created.ID || profile.EmailVerified {
+		t.Fatalf("profile = %+v", profile)
+	}
+}
+
+func TestRegisterRejectsInvalidInput(t *testing.T) {
+	app := routestest.New(t)
+
+	tests := []struct {
+		name  string
+		body  map[string]string
+		field string
+	}{
+		{"invalid email", map[string]string{"email": "not-an-email", "password": "s3cretpass", "first_name": "Nina", "birth_date": "1995-05-05"}, "email"},
+		{"weak password", map[string]string{"email": "new@example.com", "password": "short", "first_name": "Nina", "birth_date": "1995-05-05"}, "password"},
+		{"blank first name", map[string]string{"email": "new@example.com", "password": "s3cretpass", "first_name": "   ", "birth_date": "1995-05-05"}, "first_name"},
+		{"future birth date", map[string]string{"email": "new@example.com", "password": "s3cretpass", "first_name": "Nina", "birth_date": "2999-01-01"}, "birth_date"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var apiErr utils.APIError
+			app.Client(t).Post("/users/register", tt.body).ExpectStatus(http.StatusBadRequest).Decode(&apiErr)
+			if len(apiErr.Errors) != 1 || apiErr.Errors[0].Field != tt.field {
+				t.Fatalf("errors = %+v, want one for %s", apiErr.Errors, tt.field)
+			}
+		})
+	}
+}
+
+func TestRegisterRejectsTakenEmail(t *testing.T) {
+	app := routestest.New(t)
+
+	for _, email := range []string{routestest.UserEmail, " User@Example.COM "} {
+		app.Client(t).Post("/users/register", map[string]string{
+			"email":      email,
+			"password":   "s3cretpass",
+			"first_name": "Copy",
+			"birth_date": "1995-05-05",
+		}).ExpectError(http.StatusBadRequest, "Failed to create user.")
+	}
+}
+
+func TestEmailsIgnoreCase(t *testing.T) {
+	app := routestest.New(t)
+
+	var created controllers.UserOutput
+	app.Client(t).Post("/users/register", map[string]string{
+		"email":      " New@Example.com",
+		"password":   "s3cretpass",
+		"first_name": "Nina",
+		"birth_date": "1995-05-05",
+	}).ExpectStatus(http.StatusOK).Decode(&created)
+	if created.Email != "new@example.com" {
+		t.Fatalf("registered email = %q, want it lowercased", created.Email)
+	}
+
+	app.Login(t, "NEW@example.com ", "s3cretpass")
+
+	app.Client(t).Post("/users/password/forgot", map[string]string{"email": "New@EXAMPLE.com"}).ExpectStatus(http.StatusOK)
+	if msg, ok := app.Mailer.Last("new@example.com"); !ok || msg.Subject != "Reset your password" {
+		t.Fatalf("last email = %+v, want the reset email", msg)
+	}
+}
+
+func TestLoginRejectsInvalidCredentials(t *testing.T) {
+	app := routestest.New(t)
+
+	tests := []struct {
+		name     string
+		email    string
+		password string
+	}{
+		{"wrong password", routestest.UserEmail, "wrong-password1"},
+		{"unknown email", "nobody@example.com", routestest.UserPassword},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := app.Client(t).Post("/users/login", map[string]string{"email": tt.email, "password": tt.password})
+			res.ExpectError(http.StatusUnauthorized, "Invalid email or password")
+		})
+	}
+}
+
+func TestLoginUpgradesOutdatedHashes(t *testing.T) {
+	app := routestest.New(t, func(cfg *config.Config) {
+		cfg.Password.BcryptCost = 5
+	})
+	argon2 := &auth.PasswordHasher{Algorithm: auth.HashArgon2id, Argon2: auth.DefaultArgon2Params}
+	weak := &auth.PasswordHasher{Algorithm: auth.HashBcrypt, BcryptCost: 4}
+
+	for _, old := range []*auth.PasswordHasher{weak, argon2} {
+		t.Run(old.Algorithm, func(t *testing.T) {
+			hash, err := old.Hash(routestest.UserPassword)
+			if err != nil {
+				t.Fatal(err)
+			}
+			user := app.User(t, routestest.UserEmail)
+			if err := app.DB.Model(&user).Update("password_hash", hash).Error; err != nil {
+				t.Fatal(err)
+			}
+
+			app.Login(t, routestest.UserEmail, routestest.UserPassword)
+			upgraded := app.User(t, routestest.UserEmail).Password
+			if cost, err := bcrypt.Cost([]byte(upgraded)); err != nil || cost != 5 {
+				t.Fatalf("stored hash %q has cost %d (%v), want a bcrypt hash of cost 5", upgraded, cost, err)
+			}
+			app.Login(t, routestest.UserEmail, routestest.UserPassword)
+		})
+	}
+}
+
+func TestProtectedRoutesRequireToken(t *testing.T) {
+	app := routestest.New(t)
+
+	app.Client(t).Get("/users/carts").ExpectError(http.StatusUnauthorized, "Missing or malformed token")
+	app.Client(t).WithHeader("Authorization", "Bearer not-a-token").Get("/users/carts").
+		ExpectError(http.StatusUnauthorized, "Invalid or expired token")
+}
+
+func TestLogoutRevokesToken(t *testing.T) {
+	app := routestest.New(t)
+	client := app.Login(t, routestest.UserEmail, routestest.UserPassword)
+
+	client.Post("/users/logout", nil).ExpectStatus(http.StatusOK)
+	client.Get("/users/me").ExpectError(http.StatusUnauthorized, "Token has been revoked")
+}
+
+func TestDeleteAccountRemovesCredentials(t *testing.T) {
+	app := routestest.New(t)
+	client := app.Login(t, routestest.UserEmail, routestest.UserPassword)
+	other := app.Login(t, routestest.UserEmail, routestest.UserPassword)
+	key := createAPIKey(t, client, auth.ScopeCatalogRead)
+
+	client.Do(http.MethodDelete, "/users/me", map[string]string{"password": routestest.UserPassword}).
+		ExpectStatus(http.StatusOK)
+
+	client.Get("/users/me").ExpectError(http.StatusUnauthorized, "Token has been revoked")
+	other.Get("/users/me").ExpectError(http.StatusUnauthorized, "Token has been revoked")
+	app.Client(t).WithHeader(auth.APIKeyHeader, key.Key).Get("/books/all").
+		ExpectError(http.StatusUnauthorized, "Invalid, expired or revoked API key")
+	app.Client(t).Post("/users/login", map[string]string{"email": routestest.UserEmail, "password": routestest.UserPassword}).
+		ExpectError(http.StatusUnauthorized, "Invalid email or password")
+}
+
+func TestTopup(t *testing.T) {
+	app := routestest.New(t)
+	client := app.Login(t, routestest.UserEmail, routestest.UserPassword)
+
+	var res map[string]string
+	client.Post("/users/topup", map[string]uint{"amount": 25000}).ExpectStatus(http.StatusOK).Decode(&res)
+	if !strings.HasSuffix(res["message"], ": 75000") {
+		t.Fatalf("message = %q, want the new deposit of 75000", res["message"])
+	}
+	if deposit := app.User(t, routestest.UserEmail).Deposit; deposit != 75000 {
+		t.Fatalf("deposit = %d, want 75000", deposit)
+	}
+
+	client.Post("/users/topup", map[string]uint{"amount": 0}).ExpectStatus(http.StatusBadRequest)
+}
+
+// failLogins makes n failed logins for different unknown accounts, so only
+// the IP address limit counts them, each claiming another forwarded-for IP.
+func failLogins(t *testing.T, app *routestest.App, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		app.Client(t).WithHeader("X-Forwarded-For", fmt.Sprintf("203.0.113.%d", i)).
+			Post("/users/login", map[string]string{"email": fmt.Sprintf("nobody%d@example.com", i), "password": "wrong-password1"}).
+			ExpectError(http.StatusUnauthorized, "Invalid email or password")
+	}
+}
+
+func TestLoginIPLimitIgnoresForwardedFor(t *testing.T) {
+	app := routestest.New(t)
+	failLogins(t, app, auth.DefaultIPPolicy.FreeAttempts+1)
+
+	app.Client(t).WithHeader("X-Forwarded-For", "198.51.100.7").
+		Post("/users/login", map[string]string{"email": routestest.UserEmail, "password": routestest.UserPassword}).
+		ExpectError(http.StatusTooManyRequests, "Too many failed login attempts, please try again later")
+}
+
+func TestLoginIPLimitTrustsConfiguredProxies(t *testing.T) {
+	// Requests served by httptest come from 192.0.2.1
+	app := routestest.New(t, func(cfg *config.Config) {
+		cfg.Server.TrustedProxies = []string{"192.0.2.0/24"}
+	})
+	failLogins(t, app, auth.DefaultIPPolicy.FreeAttempts+1)
+
+	app.Client(t).WithHeader("X-Forwarded-For", "198.51.100.7").
+		Post("/users/login", map[string]string{"email": routestest.UserEmail, "password": routestest.UserPassword}).
+		ExpectStatus(http.StatusOK)
+}
+
+func TestLoginLockoutUntilAdminUnlocks(t *testing.T) {
+	app := routestest.New(t)
+	// No delays before the lockout, so the failures need no waiting
+	app.Limiter.Account = auth.LimitPolicy{FreeAttempts: 3, LockoutAfter: 3, LockoutDuration: time.Hour, ResetAfter: time.Hour}
+	wrong := map[string]string{"email": routestest.UserEmail, "password": "wrong-password1"}
+	right := map[string]string{"email": routestest.UserEmail, "password": routestest.UserPassword}
+
+	for i := 0; i < 3; i++ {
+		app.Client(t).Post("/users/login", wrong).ExpectError(http.StatusUnauthorized, "Invalid email or password")
+	}
+	// Locked even with the right password
+	res := app.Client(t).Post("/users/login", right)
+	res.ExpectError(http.StatusTooManyRequests, "Too many failed login attempts, please try again later")
+	if retry := res.Header().Get("Retry-After"); retry != "3600" {
+		t.Fatalf("Retry-After = %q, want the lockout of 3600 seconds", retry)
+	}
+
+	user := app.User(t, routestest.UserEmail)
+	app.LoginAdmin(t).Post(fmt.Sprintf("/admin/users/%d/unlock", user.ID), nil).ExpectStatus(http.StatusOK)
+	app.Login(t, routestest.UserEmail, routestest.UserPassword)
+}
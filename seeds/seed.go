@@ -0,0 +1,305 @@
+// Package seeds fills a database with fixtures: authors, categories, books
+// with their copies, and users that can log in. The fixtures for each
+// environment live in fixtures/<environment>.yaml (or .json) and are embedded
+// in the binary.
+package seeds
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"errors"
+	"finalp2/auth"
+	"finalp2/models"
+	"finalp2/utils"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+)
+
+//go:embed fixtures
+var fixtures embed.FS
+
+// Fixtures is the content of a fixture file. Books refer to their author by
+// full name and to their category by name, both of which must be in the
+// same file.
+type Fixtures struct {
+	Authors    []Author   `yaml:"authors" json:"authors" validate:"dive"`
+	Categories []Category `yaml:"categories" json:"categories" validate:"dive"`
+	Books      []Book     `yaml:"books" json:"books" validate:"dive"`
+	Users      []User     `yaml:"users" json:"users" validate:"dive"`
+}
+
+type Author struct {
+	FirstName   string `yaml:"first_name" json:"first_name" validate:"required,notblank,max=255"`
+	LastName    string `yaml:"last_name" json:"last_name" validate:"max=255"`
+	Nationality string `yaml:"nationality" json:"nationality" validate:"max=255"`
+	BirthDate   string `yaml:"birth_date" json:"birth_date" validate:"required,datetime=2006-01-02"`
+}
+
+// FullName is how books refer to the author.
+func (a Author) FullName() string {
+	return strings.TrimSpace(a.FirstName + " " + a.LastName)
+}
+
+type Category struct {
+	Name string `yaml:"name" json:"name" validate:"required,notblank,max=255"`
+}
+
+type Book struct {
+	Title       string `yaml:"title" json:"title" validate:"required,notblank,max=255"`
+	Isbn        string `yaml:"isbn" json:"isbn" validate:"required,notblank,max=20"`
+	Author      string `yaml:"author" json:"author" validate:"required"`
+	Category    string `yaml:"category" json:"category" validate:"required"`
+	Stock       uint   `yaml:"stock" json:"stock"`
+	Price       uint   `yaml:"price" json:"price" validate:"required"`
+	ReadingDays uint   `yaml:"reading_days" json:"reading_days" validate:"required"`
+	// Copies are the barcodes of the book's physical copies.
+	Copies []string `yaml:"copies" json:"copies" validate:"unique,dive,required,notblank,max=50"`
+}
+
+// User is seeded with a real hash of Password, so it can log in.
+type User struct {
+	Email         string `yaml:"email" json:"email" validate:"required,email,max=255"`
+	Password      string `yaml:"password" json:"password" validate:"required,password"`
+	FirstName     string `yaml:"first_name" json:"first_name" validate:"required,notblank,max=255"`
+	LastName      string `yaml:"last_name" json:"last_name" validate:"max=255"`
+	BirthDate     string `yaml:"birth_date" json:"birth_date" validate:"required,birthdate"`
+	Address       string `yaml:"address" json:"address" validate:"max=1000"`
+	Contact       string `yaml:"contact_no" json:"contact_no" validate:"phone"`
+	Deposit       uint   `yaml:"deposit" json:"deposit"`
+	Role          string `yaml:"role" json:"role" validate:"omitempty,oneof=customer staff admin"`
+	EmailVerified bool   `yaml:"email_verified" json:"email_verified"`
+}
+
+// Count is how many rows of one kind were created, and how many already
+// existed and were left alone.
+type Count struct {
+	Created  int
+	Existing int
+}
+
+func (c *Count) add(created bool) {
+	if created {
+		c.Created++
+	} else {
+		c.Existing++
+	}
+}
+
+// Result reports what a Seed call did.
+type Result struct {
+	Authors    Count
+	Categories Count
+	Books      Count
+	Copies     Count
+	Users      Count
+}
+
+// Load returns the fixtures for name, which is either an environment with
+// embedded fixtures, such as "development", or the path of a YAML or JSON
+// file.
+func Load(name string) (*Fixtures, error) {
+	if ext := filepath.Ext(name); ext != "" {
+		raw, err := os.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		return parse(name, raw)
+	}
+
+	for _, ext := range []string{".yaml", ".yml", ".json"} {
+		path := "fixtures/" + name + ext
+		raw, err := fs.ReadFile(fixtures, path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return parse(path, raw)
+	}
+	return nil, fmt.Errorf("no fixtures for environment %q", name)
+}
+
+// parse decodes the file by its extension and validates the fixtures.
+func parse(path string, raw []byte) (*Fixtures, error) {
+	f := new(Fixtures)
+	switch filepath.Ext(path) {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(raw))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(f); err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", path, err)
+		}
+	case ".json":
+		decoder := json.NewDecoder(bytes.NewReader(raw))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(f); err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", path, err)
+		}
+	default:
+		return nil, fmt.Errorf("fixtures must be YAML or JSON, got %s", path)
+	}
+
+	if err := f.validate(); err != nil {
+		return nil, fmt.Errorf("invalid fixtures in %s: %w", path, err)
+	}
+	return f, nil
+}
+
+// validate checks every field and that the books' references resolve.
+func (f *Fixtures) validate() error {
+	if err := utils.NewValidator().Validate(f); err != nil {
+		apiErr := utils.ToAPIError(err, "Invalid fixtures")
+		messages := make([]string, 0, len(apiErr.Errors))
+		for _, fieldErr := range apiErr.Errors {
+			messages = append(messages, fieldErr.Field+" "+fieldErr.Message)
+		}
+		if len(messages) == 0 {
+			return errors.New(apiErr.Message)
+		}
+		return errors.New(strings.Join(messages, "; "))
+	}
+
+	authors := map[string]bool{}
+	for _, author := range f.Authors {
+		authors[author.FullName()] = true
+	}
+	categories := map[string]bool{}
+	for _, category := range f.Categories {
+		categories[category.Name] = true
+	}
+	for _, book := range f.Books {
+		if !authors[book.Author] {
+			return fmt.Errorf("book %q refers to unknown author %q", book.Title, book.Author)
+		}
+		if !categories[book.Category] {
+			return fmt.Errorf("book %q refers to unknown category %q", book.Title, book.Category)
+		}
+	}
+	return nil
+}
+
+// Seed creates the rows in f that don't exist yet, in one transaction, so it
+// can be run again safely. Rows are matched by author name, category name,
+// ISBN, copy barcode and user email; rows that already exist are not changed,
+// which keeps passwords people changed since the last run.
+func Seed(db *gorm.DB, hasher *auth.PasswordHasher, f *Fixtures) (Result, error) {
+	var result Result
+	err := db.Transaction(func(tx *gorm.DB) error {
+		authorIDs := map[string]uint{}
+		for _, fixture := range f.Authors {
+			author := models.Author{
+				FirstName:   fixture.FirstName,
+				LastName:    fixture.LastName,
+				Nationality: fixture.Nationality,
+				BirthDate:   fixture.BirthDate,
+			}
+			created, err := firstOrCreate(tx, &author, "first_name = ? AND last_name = ?", author.FirstName, author.LastName)
+			if err != nil {
+				return fmt.Errorf("seeding author %q: %w", fixture.FullName(), err)
+			}
+			result.Authors.add(created)
+			authorIDs[fixture.FullName()] = author.ID
+		}
+
+		categoryIDs := map[string]uint{}
+		for _, fixture := range f.Categories {
+			category := models.Category{Name: fixture.Name}
+			created, err := firstOrCreate(tx, &category, "name = ?", category.Name)
+			if err != nil {
+				return fmt.Errorf("seeding category %q: %w", fixture.Name, err)
+			}
+			result.Categories.add(created)
+			categoryIDs[fixture.Name] = category.ID
+		}
+
+		for _, fixture := range f.Books {
+			book := models.Book{
+				Title:       fixture.Title,
+				AuthorID:    authorIDs[fixture.Author],
+				CategoryID:  categoryIDs[fixture.Category],
+				Isbn:        fixture.Isbn,
+				Stock:       fixture.Stock,
+				Price:       fixture.Price,
+				ReadingDays: fixture.ReadingDays,
+			}
+			created, err := firstOrCreate(tx, &book, "isbn = ?", book.Isbn)
+			if err != nil {
+				return fmt.Errorf("seeding book %q: %w", fixture.Title, err)
+			}
+			result.Books.add(created)
+
+			for _, barcode := range fixture.Copies {
+				bookCopy := models.BookCopy{BookID: book.ID, Barcode: barcode, Status: models.CopyAvailable}
+				created, err := firstOrCreate(tx, &bookCopy, "barcode = ?", barcode)
+				if err != nil {
+					return fmt.Errorf("seeding copy %s: %w", barcode, err)
+				}
+				result.Copies.add(created)
+			}
+		}
+
+		for _, fixture := range f.Users {
+			email := utils.NormalizeEmail(fixture.Email)
+
+			var existing int64
+			if err := tx.Model(&models.User{}).Where("email = ?", email).Count(&existing).Error; err != nil {
+				return fmt.Errorf("seeding user %s: %w", email, err)
+			}
+			if existing > 0 {
+				result.Users.add(false)
+				continue
+			}
+
+			hash, err := hasher.Hash(fixture.Password)
+			if err != nil {
+				return fmt.Errorf("hashing password of %s: %w", email, err)
+			}
+			user := models.User{
+				Email:      email,
+				Password:   hash,
+				FirstName:  fixture.FirstName,
+				LastName:   fixture.LastName,
+				Birth_date: fixture.BirthDate,
+				Address:    fixture.Address,
+				Contact:    utils.NormalizePhone(fixture.Contact),
+				Deposit:    fixture.Deposit,
+				Role:       fixture.Role,
+			}
+			if user.Role == "" {
+				user.Role = models.RoleCustomer
+			}
+			if fixture.EmailVerified {
+				now := time.Now()
+				user.EmailVerifiedAt = &now
+			}
+			if err := tx.Create(&user).Error; err != nil {
+				return fmt.Errorf("seeding user %s: %w", email, err)
+			}
+			result.Users.add(true)
+		}
+		return nil
+	})
+	return result, err
+}
+
+// firstOrCreate loads the row matching the query into dest, or creates dest
+// when there is none. It reports whether the row was created.
+func firstOrCreate(tx *gorm.DB, dest interface{}, query string, args ...interface{}) (bool, error) {
+	result := tx.Where(query, args...).Limit(1).Find(dest)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected > 0 {
+		return false, nil
+	}
+	return true, tx.Create(dest).Error
+}
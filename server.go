@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"finalp2/controllers"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// server runs the API and its background workers until it is asked to
+// stop, then shuts them down in order: readiness checks fail while requests
+// are still taken for drainDelay, in-flight requests get shutdownTimeout to
+// finish, the workers are cancelled and get shutdownTimeout to return, and
+// the closers run in the order they were registered.
+type server struct {
+	echo            *echo.Echo
+	health          *controllers.HealthHandler
+	drainDelay      time.Duration
+	shutdownTimeout time.Duration
+	workers         []worker
+	closers         []closer
+}
+
+type worker struct {
+	name string
+	run  func(ctx context.Context)
+}
+
+type closer struct {
+	name  string
+	close func() error
+}
+
+// goWorker registers fn to run in the background while the server runs. Its
+// context is cancelled once the server stopped taking requests, and the
+// closers wait for it to return, so it can still use the database.
+func (s *server) goWorker(name string, fn func(ctx context.Context)) {
+	s.workers = append(s.workers, worker{name: name, run: fn})
+}
+
+// onShutdown registers fn to run once the server stopped taking requests.
+func (s *server) onShutdown(name string, fn func() error) {
+	s.closers = append(s.closers, closer{name: name, close: fn})
+}
+
+// run listens on addr until ctx is done or the server fails, and shuts down
+// either way. The error is nil only for a clean shutdown.
+func (s *server) run(ctx context.Context, addr string) error {
+	stopWorkers := s.startWorkers()
+
+	// Buffered, as nobody reads it after a shutdown
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- s.echo.Start(addr)
+	}()
+
+	var err error
+	select {
+	case <-ctx.Done():
+		log.Println("Shutting down the server...")
+		err = s.shutdown()
+	case serveErr := <-serveErr:
+		err = fmt.Errorf("running the server: %w", serveErr)
+	}
+	return errors.Join(err, stopWorkers(), s.close())
+}
+
+// startWorkers runs every worker in its own goroutine. The returned function
+// cancels them and waits until they returned or shutdownTimeout passed.
+func (s *server) startWorkers() (stop func() error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var mu sync.Mutex
+	running := make(map[string]bool, len(s.workers))
+	var wg sync.WaitGroup
+	for _, w := range s.workers {
+		running[w.name] = true
+		wg.Add(1)
+		go func(w worker) {
+			defer wg.Done()
+			w.run(ctx)
+			mu.Lock()
+			defer mu.Unlock()
+			delete(running, w.name)
+		}(w)
+	}
+
+	return func() error {
+		cancel()
+		stopped := make(chan struct{})
+		go func() {
+			wg.Wait()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+			return nil
+		case <-time.After(s.shutdownTimeout):
+			mu.Lock()
+			defer mu.Unlock()
+			var errs []error
+			for name := range running {
+				errs = append(errs, fmt.Errorf("stopping the %s: %w", name, context.DeadlineExceeded))
+			}
+			return errors.Join(errs...)
+		}
+	}
+}
+
+// shutdown stops taking new requests and waits for the running ones. Those
+// still running at the deadline are cut off.
+func (s *server) shutdown() error {
+	// Load balancers only stop routing here once they see /readyz fail, so
+	// keep serving until they had the time to
+	s.health.Drain()
+	time.Sleep(s.drainDelay)
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.shutdownTimeout)
+	defer cancel()
+	if err := s.echo.Shutdown(ctx); err != nil {
+		s.echo.Close()
+		return fmt.Errorf("draining requests: %w", err)
+	}
+	return nil
+}
+
+// close runs every closer, even after one of them failed.
+func (s *server) close() error {
+	var errs []error
+	for _, c := range s.closers {
+		if err := c.close(); err != nil {
+			errs = append(errs, fmt.Errorf("closing the %s: %w", c.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
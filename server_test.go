@@ -0,0 +1,268 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"finalp2/routes/routestest"
+
+	"github.com/labstack/echo/v4"
+)
+
+// client opens a connection per request. The server only closes unused
+// idle connections after a while, so with keep-alives those would hold up
+// the shutdown.
+var client = &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+
+// startServer runs the app's server on a free local port until the returned
+// cancel function is called. The error of run arrives on the channel.
+func startServer(t *testing.T, srv *server) (url string, cancel context.CancelFunc, done <-chan error) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.echo.Listener = listener
+	srv.echo.HideBanner = true
+	srv.echo.HidePort = true
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	result := make(chan error, 1)
+	go func() {
+		result <- srv.run(ctx, "")
+	}()
+	return "http://" + listener.Addr().String(), cancel, result
+}
+
+// slowRoute registers a route that blocks until release is closed, and
+// returns a channel that receives a value for every request that arrived.
+func slowRoute(e *echo.Echo, release <-chan struct{}) <-chan struct{} {
+	started := make(chan struct{}, 1)
+	e.GET("/slow", func(c echo.Context) error {
+		started <- struct{}{}
+		<-release
+		return c.String(http.StatusOK, "done")
+	})
+	return started
+}
+
+func wait(t *testing.T, done <-chan error) error {
+	t.Helper()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not stop")
+		return nil
+	}
+}
+
+func TestServerShutsDownInOrder(t *testing.T) {
+	app := routestest.New(t)
+	release := make(chan struct{})
+	started := slowRoute(app.Echo, release)
+
+	var mu sync.Mutex
+	var closed []string
+	srv := &server{echo: app.Echo, health: app.Health, shutdownTimeout: 5 * time.Second}
+	srv.goWorker("worker", func(ctx context.Context) {
+		<-ctx.Done()
+		// Still finishing up when the closers could otherwise run
+		time.Sleep(50 * time.Millisecond)
+		mu.Lock()
+		defer mu.Unlock()
+		closed = append(closed, "worker")
+	})
+	for _, name := range []string{"log file", "database connection"} {
+		srv.onShutdown(name, func() error {
+			mu.Lock()
+			defer mu.Unlock()
+			closed = append(closed, name)
+			return nil
+		})
+	}
+	url, stop, done := startServer(t, srv)
+
+	slow := make(chan *http.Response, 1)
+	go func() {
+		res, err := client.Get(url + "/slow")
+		if err != nil {
+			t.Error(err)
+		}
+		slow <- res
+	}()
+	<-started
+
+	stop()
+	// Readiness fails as soon as the shutdown starts
+	deadline := time.Now().Add(5 * time.Second)
+	for app.Client(t).Get("/readyz").Status() != http.StatusServiceUnavailable {
+		if time.Now().After(deadline) {
+			t.Fatal("readiness still passes during the shutdown")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// The request in flight finishes before anything is closed
+	mu.Lock()
+	if len(closed) != 0 {
+		t.Errorf("closed %v while a request was running", closed)
+	}
+	mu.Unlock()
+	close(release)
+	if res := <-slow; res == nil || res.StatusCode != http.StatusOK {
+		t.Fatalf("in-flight request got %+v", res)
+	}
+
+	if err := wait(t, done); err != nil {
+		t.Fatalf("run = %v, want a clean shutdown", err)
+	}
+	if got := strings.Join(closed, ", "); got != "worker, log file, database connection" {
+		t.Fatalf("closed %s", got)
+	}
+}
+
+func TestServerFailsReadinessBeforeClosing(t *testing.T) {
+	app := routestest.New(t)
+	srv := &server{echo: app.Echo, health: app.Health, drainDelay: 500 * time.Millisecond, shutdownTimeout: time.Second}
+	url, stop, done := startServer(t, srv)
+
+	res, err := client.Get(url + "/readyz")
+	if err != nil || res.StatusCode != http.StatusOK {
+		t.Fatalf("readiness before the shutdown = %v, %v", res, err)
+	}
+	res.Body.Close()
+
+	stop()
+	for {
+		res, err := client.Get(url + "/readyz")
+		if err != nil {
+			t.Fatalf("server stopped taking requests before readiness failed: %v", err)
+		}
+		res.Body.Close()
+		if res.StatusCode == http.StatusServiceUnavailable {
+			break
+		}
+	}
+	// Other requests are still served while load balancers catch up
+	res, err = client.Get(url + "/healthz")
+	if err != nil || res.StatusCode != http.StatusOK {
+		t.Fatalf("request during the drain delay = %v, %v", res, err)
+	}
+	res.Body.Close()
+
+	if err := wait(t, done); err != nil {
+		t.Fatalf("run = %v, want a clean shutdown", err)
+	}
+}
+
+func TestServerCutsOffRequestsAfterTheTimeout(t *testing.T) {
+	app := routestest.New(t)
+	release := make(chan struct{})
+	defer close(release)
+	started := slowRoute(app.Echo, release)
+
+	dbClosed := false
+	srv := &server{echo: app.Echo, health: app.Health, shutdownTimeout: 50 * time.Millisecond}
+	srv.onShutdown("database connection", func() error {
+		dbClosed = true
+		return nil
+	})
+	url, stop, done := startServer(t, srv)
+
+	go client.Get(url + "/slow")
+	<-started
+	stop()
+
+	err := wait(t, done)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("run = %v, want the drain deadline exceeded", err)
+	}
+	if !dbClosed {
+		t.Fatal("database not closed after a failed drain")
+	}
+}
+
+func TestServerReportsStuckWorkers(t *testing.T) {
+	app := routestest.New(t)
+	release := make(chan struct{})
+	defer close(release)
+
+	dbClosed := false
+	srv := &server{echo: app.Echo, health: app.Health, shutdownTimeout: 50 * time.Millisecond}
+	srv.goWorker("worker", func(ctx context.Context) {
+		<-release
+	})
+	srv.onShutdown("database connection", func() error {
+		dbClosed = true
+		return nil
+	})
+	_, stop, done := startServer(t, srv)
+	stop()
+
+	err := wait(t, done)
+	if !errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), "stopping the worker") {
+		t.Fatalf("run = %v, want the worker deadline exceeded", err)
+	}
+	if !dbClosed {
+		t.Fatal("database not closed after a worker did not stop")
+	}
+}
+
+func TestServerReportsCloseErrors(t *testing.T) {
+	app := routestest.New(t)
+	failure := errors.New("flush failed")
+
+	dbClosed := false
+	srv := &server{echo: app.Echo, health: app.Health, shutdownTimeout: time.Second}
+	srv.onShutdown("log file", func() error { return failure })
+	srv.onShutdown("database connection", func() error {
+		dbClosed = true
+		return nil
+	})
+	_, stop, done := startServer(t, srv)
+	stop()
+
+	err := wait(t, done)
+	if !errors.Is(err, failure) || !strings.Contains(err.Error(), "closing the log file") {
+		t.Fatalf("run = %v, want the log file error", err)
+	}
+	if !dbClosed {
+		t.Fatal("database not closed after the log file failed")
+	}
+}
+
+func TestServerFailsToListen(t *testing.T) {
+	app := routestest.New(t)
+	taken, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer taken.Close()
+
+	dbClosed := false
+	srv := &server{echo: app.Echo, health: app.Health, shutdownTimeout: time.Second}
+	srv.onShutdown("database connection", func() error {
+		dbClosed = true
+		return nil
+	})
+	app.Echo.HideBanner = true
+	done := make(chan error, 1)
+	go func() {
+		done <- srv.run(context.Background(), taken.Addr().String())
+	}()
+
+	if err := wait(t, done); err == nil || !strings.Contains(err.Error(), "running the server") {
+		t.Fatalf("run = %v, want the listen error", err)
+	}
+	if !dbClosed {
+		t.Fatal("database not closed after the server failed")
+	}
+}
@@ -0,0 +1,47 @@
+// Package services holds the business rules of the library: the catalogue,
+// carts, checkout, payments and returns. Services only talk to the database
+// through a repository.Store, and report failures as *utils.APIError values
+// the handlers can pass on unchanged.
+package services
+
+import (
+	"context"
+	"errors"
+	"finalp2/models"
+	"finalp2/repository"
+	"finalp2/utils"
+)
+
+type BookService struct {
+	store repository.Store
+}
+
+func NewBookService(store repository.Store) *BookService {
+	return &BookService{store: store}
+}
+
+// WithContext returns a copy of the service whose queries are cancelled with
+// ctx.
+func (s *BookService) WithContext(ctx context.Context) *BookService {
+	return &BookService{store: s.store.WithContext(ctx)}
+}
+
+// List returns every book with its author and category.
+func (s *BookService) List() ([]models.Book, error) {
+	books, err := s.store.Books().List()
+	if err != nil {
+		return nil, utils.NewInternalError("Error fetching books")
+	}
+	return books, nil
+}
+
+func (s *BookService) Get(id uint) (*models.Book, error) {
+	book, err := s.store.Books().FindByID(id)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, utils.NewNotFoundError("Book not found")
+	}
+	if err != nil {
+		return nil, utils.NewInternalError("Error fetching book")
+	}
+	return book, nil
+}
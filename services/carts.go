@@ -0,0 +1,86 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"finalp2/models"
+	"finalp2/repository"
+	"finalp2/utils"
+)
+
+type CartService struct {
+	store repository.Store
+}
+
+func NewCartService(store repository.Store) *CartService {
+	return &CartService{store: store}
+}
+
+// WithContext returns a copy of the service whose queries are cancelled with
+// ctx.
+func (s *CartService) WithContext(ctx context.Context) *CartService {
+	return &CartService{store: s.store.WithContext(ctx)}
+}
+
+// Books returns the books in the user's cart, in the order they were added.
+// A book added twice is listed twice.
+func (s *CartService) Books(userID uint) ([]models.Book, error) {
+	items, err := s.store.Carts().List(userID)
+	if err != nil {
+		return nil, utils.NewInternalError("Error fetching cart")
+	}
+	return cartBooks(s.store, items)
+}
+
+// Add puts the book in the user's cart.
+func (s *CartService) Add(userID, bookID uint) error {
+	if _, err := s.store.Books().FindByID(bookID); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return utils.NewBadRequestError("Book not found")
+		}
+		return utils.NewInternalError("Failed to add product to cart.")
+	}
+
+	if err := s.store.Carts().Add(&models.Cart{UserID: userID, BookID: bookID}); err != nil {
+		return utils.NewBadRequestError("Failed to add product to cart.")
+	}
+	return nil
+}
+
+// RemoveFirst takes the oldest item out of the user's cart.
+func (s *CartService) RemoveFirst(userID uint) error {
+	removed, err := s.store.Carts().RemoveFirst(userID)
+	if err != nil {
+		return utils.NewInternalError("Error deleting cart")
+	}
+	if !removed {
+		return utils.NewNotFoundError("Cart is empty")
+	}
+	return nil
+}
+
+// cartBooks loads the book of every cart item.
+func cartBooks(store repository.Store, items []models.Cart) ([]models.Book, error) {
+	ids := make([]uint, 0, len(items))
+	for _, item := range items {
+		ids = append(ids, item.BookID)
+	}
+	books, err := store.Books().FindByIDs(ids)
+	if err != nil {
+		return nil, utils.NewInternalError("Error fetching cart")
+	}
+
+	byID := make(map[uint]models.Book, len(books))
+	for _, book := range books {
+		byID[book.ID] = book
+	}
+	out := make([]models.Book, 0, len(items))
+	for _, item := range items {
+		book, ok := byID[item.BookID]
+		if !ok {
+			return nil, utils.NewInternalError("Error fetching book for cart item")
+		}
+		out = append(out, book)
+	}
+	return out, nil
+}
@@ -0,0 +1,138 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"finalp2/helper"
+	"finalp2/models"
+	"finalp2/repository"
+	"finalp2/utils"
+	"fmt"
+	"time"
+)
+
+// Invoicer creates the invoice the user pays a rental with.
+type Invoicer interface {
+	CreateInvoice(rental models.Rental, customer models.User, books []models.Book) (*helper.Invoice, error)
+}
+
+type PaymentService struct {
+	store    repository.Store
+	invoices Invoicer
+}
+
+func NewPaymentService(store repository.Store, invoices Invoicer) *PaymentService {
+	return &PaymentService{store: store, invoices: invoices}
+}
+
+// WithContext returns a copy of the service whose queries are cancelled with
+// ctx.
+func (s *PaymentService) WithContext(ctx context.Context) *PaymentService {
+	return &PaymentService{store: s.store.WithContext(ctx), invoices: s.invoices}
+}
+
+// Topup adds amount to the user's deposit and returns the new balance.
+func (s *PaymentService) Topup(userID, amount uint) (uint, error) {
+	deposit, err := s.store.Users().AddDeposit(userID, amount)
+	if err != nil {
+		return 0, utils.NewInternalError("Failed to update user")
+	}
+	return deposit, nil
+}
+
+// Pay records the payment of the customer's rental, starts the rental period
+// and creates the invoice. Each book is due after its own reading period and
+// gets a physical copy assigned when the library has registered copies for
+// it.
+func (s *PaymentService) Pay(customer models.User, rentalID uint) (*models.Rental, *helper.Invoice, error) {
+	rental, err := s.store.Rentals().FindByID(rentalID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, nil, utils.NewNotFoundError("Order not found")
+	}
+	if err != nil {
+		return nil, nil, utils.NewInternalError("Error fetching order")
+	}
+
+	if rental.UserID != customer.ID {
+		return nil, nil, utils.NewUnauthorizedError("You are not authorized to pay for this order")
+	}
+
+	// Check if the order can still be paid
+	switch {
+	case rental.RentalStatus == models.RentalPaid || rental.RentalStatus == models.RentalActive:
+		return nil, nil, utils.NewBadRequestError("Order is already paid")
+	case !rental.RentalStatus.CanTransitionTo(models.RentalPaid):
+		return nil, nil, utils.NewBadRequestError(fmt.Sprintf("Order with status %s cannot be paid", rental.RentalStatus))
+	}
+
+	items, err := s.store.Rentals().Details(rental.ID)
+	if err != nil {
+		return nil, nil, utils.NewInternalError("Error fetching ordered books")
+	}
+	books := make([]models.Book, len(items))
+	for i, item := range items {
+		books[i] = item.Book
+	}
+
+	// Mark the order as paid, then start the rental period
+	now := time.Now()
+	payment := models.Payment{
+		RentalID:      rental.ID,
+		PaymentDate:   now.Format("2006-01-02"),
+		PaymentAmount: float64(rental.TotalPrice),
+	}
+	err = s.store.Transaction(func(tx repository.Store) error {
+		rentals := tx.Rentals()
+		if err := rentals.Transition(rental, models.RentalPaid, &customer.ID, "payment received"); err != nil {
+			return err
+		}
+		if err := tx.Payments().Create(&payment); err != nil {
+			return err
+		}
+
+		rental.RentalDate = &now
+		if err := rentals.Update(rental, map[string]interface{}{"rental_date": now}); err != nil {
+			return err
+		}
+		if err := rentals.Transition(rental, models.RentalActive, &customer.ID, "rental started"); err != nil {
+			return err
+		}
+
+		for i := range items {
+			dueDate := now.AddDate(0, 0, int(books[i].ReadingDays))
+			updates := map[string]interface{}{"due_date": dueDate}
+
+			bookCopy, err := tx.Books().ReserveCopy(items[i].BookID)
+			if err != nil {
+				return err
+			}
+			if bookCopy != nil {
+				updates["copy_id"] = bookCopy.ID
+			}
+
+			if err := rentals.UpdateDetail(&items[i], updates); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, repository.ErrStatusConflict) {
+		return nil, nil, utils.NewConflictError("Order is already being paid")
+	}
+	if err != nil {
+		return nil, nil, utils.NewInternalError("Failed to update order status to paid")
+	}
+
+	invoice, err := s.invoices.CreateInvoice(*rental, customer, books)
+	if err != nil {
+		return nil, nil, utils.NewInternalError("Error while creating invoice")
+	}
+
+	payment.InvoiceID = invoice.ID
+	payment.InvoiceURL = invoice.InvoiceUrl
+	if err := s.store.Payments().Save(&payment); err != nil {
+		return nil, nil, utils.NewInternalError("Failed to save invoice")
+	}
+
+	return rental, invoice, nil
+}
@@ -0,0 +1,283 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"finalp2/models"
+	"finalp2/repository"
+	"finalp2/utils"
+	"fmt"
+	"time"
+)
+
+// ReturnableStatuses are the statuses of rentals whose books are still out.
+var ReturnableStatuses = []models.RentalStatus{
+	models.RentalActive,
+	models.RentalOverdue,
+	models.RentalPartiallyReturned,
+}
+
+type RentalService struct {
+	store repository.Store
+}
+
+func NewRentalService(store repository.Store) *RentalService {
+	return &RentalService{store: store}
+}
+
+// WithContext returns a copy of the service whose queries are cancelled with
+// ctx.
+func (s *RentalService) WithContext(ctx context.Context) *RentalService {
+	return &RentalService{store: s.store.WithContext(ctx)}
+}
+
+// Checkout turns the user's cart into a rental awaiting payment and empties
+// the cart.
+func (s *RentalService) Checkout(userID uint) (*models.Rental, error) {
+	items, err := s.store.Carts().List(userID)
+	if err != nil {
+		return nil, utils.NewInternalError("Error fetching cart")
+	}
+	if len(items) == 0 {
+		return nil, utils.NewBadRequestError("Cart is empty, cannot create order")
+	}
+
+	books, err := cartBooks(s.store, items)
+	if err != nil {
+		return nil, err
+	}
+
+	rental := &models.Rental{
+		UserID:       userID,
+		RentalStatus: models.RentalCreated,
+	}
+	for _, book := range books {
+		rental.TotalPrice += book.Price
+	}
+
+	err = s.store.Transaction(func(tx repository.Store) error {
+		rentals := tx.Rentals()
+		if err := rentals.Create(rental); err != nil {
+			return utils.NewInternalError("Failed to create order")
+		}
+		if err := rentals.RecordStatus(rental.ID, "", rental.RentalStatus, &userID, "order created"); err != nil {
+			return utils.NewInternalError("Failed to create order")
+		}
+
+		for _, item := range items {
+			detail := models.RentalDetail{RentalID: rental.ID, BookID: item.BookID}
+			if err := rentals.AddDetail(&detail); err != nil {
+				return utils.NewInternalError("Failed to create order item")
+			}
+		}
+
+		// The order now waits for the user to pay
+		if err := rentals.Transition(rental, models.RentalPendingPayment, &userID, "awaiting payment"); err != nil {
+			return utils.NewInternalError("Failed to create order")
+		}
+
+		if err := tx.Carts().Clear(userID); err != nil {
+			return utils.NewInternalError("Failed to clear cart after creating order")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rental, nil
+}
+
+// History returns a page of the user's rentals, newest first, and the number
+// of rentals matching the filter. Pages start at 1.
+func (s *RentalService) History(userID uint, filter repository.RentalFilter, page, limit int) ([]models.Rental, int64, error) {
+	rentals, total, err := s.store.Rentals().List(userID, filter, (page-1)*limit, limit)
+	if err != nil {
+		return nil, 0, utils.NewInternalError("Error fetching orders")
+	}
+	return rentals, total, nil
+}
+
+// OrderDetail is a rental with its items and payments.
+type OrderDetail struct {
+	Rental   models.Rental
+	Items    []models.RentalDetail
+	Payments []models.Payment
+}
+
+// Order returns a rental for its owner or library staff.
+func (s *RentalService) Order(viewer models.User, rentalID uint) (*OrderDetail, error) {
+	rental, err := s.store.Rentals().FindByID(rentalID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, utils.NewNotFoundError("Order not found")
+	}
+	if err != nil {
+		return nil, utils.NewInternalError("Error fetching order")
+	}
+	if rental.UserID != viewer.ID && !viewer.IsStaff() {
+		return nil, utils.NewForbiddenError("You are not allowed to view this order")
+	}
+
+	items, err := s.store.Rentals().Details(rental.ID)
+	if err != nil {
+		return nil, utils.NewInternalError("Error fetching rent detail")
+	}
+	payments, err := s.store.Payments().ListByRental(rental.ID)
+	if err != nil {
+		return nil, utils.NewInternalError("Error fetching payments")
+	}
+
+	return &OrderDetail{Rental: *rental, Items: items, Payments: payments}, nil
+}
+
+// HasOutstandingRentals reports whether the user still has books out.
+func (s *RentalService) HasOutstandingRentals(userID uint) (bool, error) {
+	count, err := s.store.Rentals().CountByStatus(userID, ReturnableStatuses)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// ReturnedItem is a rental item that was returned, with the status its rental
+// ended up in.
+type ReturnedItem struct {
+	RentalDetailID uint
+	RentalID       uint
+	BookID         uint
+	RentalStatus   models.RentalStatus
+}
+
+// ReturnBook returns the user's copy of the book that is due first.
+func (s *RentalService) ReturnBook(userID, bookID uint) ([]ReturnedItem, error) {
+	item, err := s.store.Rentals().FindOutstandingByBook(userID, bookID, ReturnableStatuses)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, utils.NewNotFoundError("Rental detail not found")
+	}
+	if err != nil {
+		return nil, utils.NewInternalError("Error fetching rental detail")
+	}
+	return s.returnItems([]models.RentalDetail{*item}, userID)
+}
+
+// Return returns the items addressed by rental detail ID or by the barcode
+// of the copy that was handed out, on behalf of actorID. When owner is set,
+// every item must belong to that user's rentals. Either all items are
+// returned or none is.
+func (s *RentalService) Return(owner *uint, detailIDs []uint, barcodes []string, actorID uint) ([]ReturnedItem, error) {
+	var items []models.RentalDetail
+	seen := map[uint]bool{}
+	rentals := s.store.Rentals()
+
+	for _, id := range detailIDs {
+		if seen[id] {
+			continue
+		}
+		item, err := rentals.FindDetail(owner, id)
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, utils.NewNotFoundError(fmt.Sprintf("Rental detail %d not found", id))
+		}
+		if err != nil {
+			return nil, utils.NewInternalError("Error fetching rental detail")
+		}
+		seen[item.ID] = true
+		items = append(items, *item)
+	}
+
+	for _, barcode := range barcodes {
+		item, err := rentals.FindOutstandingByBarcode(owner, barcode)
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, utils.NewNotFoundError(fmt.Sprintf("No outstanding rental found for copy %s", barcode))
+		}
+		if err != nil {
+			return nil, utils.NewInternalError("Error fetching rental detail")
+		}
+		if seen[item.ID] {
+			continue
+		}
+		seen[item.ID] = true
+		items = append(items, *item)
+	}
+
+	return s.returnItems(items, actorID)
+}
+
+// returnItems marks the rental details as returned, puts the books and copies
+// back in stock and moves every affected rental to its next status.
+func (s *RentalService) returnItems(items []models.RentalDetail, actorID uint) ([]ReturnedItem, error) {
+	var out []ReturnedItem
+	err := s.store.Transaction(func(tx repository.Store) error {
+		rentalRepo := tx.Rentals()
+		rentals := map[uint]*models.Rental{}
+		var rentalOrder []uint
+		now := time.Now()
+
+		for _, item := range items {
+			rental, ok := rentals[item.RentalID]
+			if !ok {
+				var err error
+				rental, err = rentalRepo.FindByID(item.RentalID)
+				if err != nil {
+					return utils.NewInternalError("Error fetching rental")
+				}
+				if !rental.RentalStatus.CanTransitionTo(models.RentalReturned) {
+					return utils.NewBadRequestError(fmt.Sprintf("Books cannot be returned for rental %d with status %s", rental.ID, rental.RentalStatus))
+				}
+				rentals[rental.ID] = rental
+				rentalOrder = append(rentalOrder, rental.ID)
+			}
+
+			returned, err := rentalRepo.MarkReturned(item.ID, now)
+			if err != nil {
+				return utils.NewInternalError("Failed to update rental detail")
+			}
+			if !returned {
+				return utils.NewBadRequestError(fmt.Sprintf("Rental detail %d is already returned", item.ID))
+			}
+
+			if err := tx.Books().IncrementStock(item.BookID); err != nil {
+				return utils.NewInternalError("Failed to update book stock")
+			}
+			if item.CopyID != nil {
+				if err := tx.Books().ReleaseCopy(*item.CopyID); err != nil {
+					return utils.NewInternalError("Failed to update book copy")
+				}
+			}
+
+			out = append(out, ReturnedItem{RentalDetailID: item.ID, RentalID: item.RentalID, BookID: item.BookID})
+		}
+
+		// If all books in a rental are returned, the rental is complete
+		for _, rentalID := range rentalOrder {
+			rental := rentals[rentalID]
+
+			outstandingBooks, err := rentalRepo.CountOutstanding(rental.ID)
+			if err != nil {
+				return utils.NewInternalError("Failed to update rental status")
+			}
+
+			next := models.RentalPartiallyReturned
+			if outstandingBooks == 0 {
+				next = models.RentalReturned
+			}
+			if rental.RentalStatus != next {
+				err := rentalRepo.Transition(rental, next, &actorID, "books returned")
+				if errors.Is(err, repository.ErrStatusConflict) {
+					return utils.NewConflictError(fmt.Sprintf("Rental %d was changed by another request, try again", rental.ID))
+				}
+				if err != nil {
+					return utils.NewInternalError("Failed to update rental status")
+				}
+			}
+		}
+
+		for i := range out {
+			out[i].RentalStatus = rentals[out[i].RentalID].RentalStatus
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
@@ -0,0 +1,223 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"finalp2/models"
+	"finalp2/oidc"
+	"finalp2/repository"
+	"finalp2/utils"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// MaxActiveAPIKeys is how many working API keys a user may have at once.
+const MaxActiveAPIKeys = 25
+
+// UserService changes accounts where more than one table is involved. Errors
+// other than *utils.APIError are failures of the database.
+type UserService struct {
+	store repository.Store
+}
+
+func NewUserService(store repository.Store) *UserService {
+	return &UserService{store: store}
+}
+
+// WithContext returns a copy of the service whose queries are cancelled with
+// ctx.
+func (s *UserService) WithContext(ctx context.Context) *UserService {
+	return &UserService{store: s.store.WithContext(ctx)}
+}
+
+// UpdateProfile sets the given columns of the user and returns the result.
+func (s *UserService) UpdateProfile(userID uint, updates map[string]interface{}) (*models.User, error) {
+	if len(updates) > 0 {
+		if err := s.store.Users().Update(userID, updates); err != nil {
+			return nil, err
+		}
+	}
+	return s.store.Users().FindByID(userID)
+}
+
+// SetPassword stores the new password hash and logs out every session of the
+// user but keepSessionID, which may be empty.
+func (s *UserService) SetPassword(userID uint, hash, keepSessionID string) error {
+	return s.store.Transaction(func(tx repository.Store) error {
+		if err := tx.Users().Update(userID, map[string]interface{}{"password_hash": hash}); err != nil {
+			return err
+		}
+		if keepSessionID == "" {
+			return tx.Sessions().RevokeAll(userID)
+		}
+		return tx.Sessions().RevokeOthers(userID, keepSessionID)
+	})
+}
+
+// DeleteAccount removes the user's personal data and everything they could
+// sign in with. Rentals and payments stay for the library's records.
+func (s *UserService) DeleteAccount(userID uint) error {
+	return s.store.Transaction(func(tx repository.Store) error {
+		anonymised := map[string]interface{}{
+			"email":             fmt.Sprintf("deleted-user-%d@deleted.invalid", userID),
+			"password_hash":     "",
+			"first_name":        "Deleted",
+			"last_name":         "User",
+			"birth_date":        nil,
+			"address":           "",
+			"contact_no":        "",
+			"email_verified_at": nil,
+			"totp_secret":       "",
+			"totp_enabled_at":   nil,
+			"deleted_at":        time.Now(),
+		}
+		if err := tx.Users().Update(userID, anonymised); err != nil {
+			return err
+		}
+		if err := tx.Carts().Clear(userID); err != nil {
+			return err
+		}
+		if err := tx.ActionTokens().DeleteAll(userID); err != nil {
+			return err
+		}
+		if err := tx.TwoFactor().DeleteRecoveryCodes(userID); err != nil {
+			return err
+		}
+		if err := tx.Identities().DeleteAll(userID); err != nil {
+			return err
+		}
+		if err := tx.APIKeys().DeleteAll(userID); err != nil {
+			return err
+		}
+		return tx.Sessions().RevokeAll(userID)
+	})
+}
+
+// EnableTwoFactor turns on two-factor authentication for the user and
+// returns their first recovery codes.
+func (s *UserService) EnableTwoFactor(userID uint) ([]string, error) {
+	var codes []string
+	err := s.store.Transaction(func(tx repository.Store) error {
+		if err := tx.Users().Update(userID, map[string]interface{}{"totp_enabled_at": time.Now()}); err != nil {
+			return err
+		}
+		var err error
+		codes, err = tx.TwoFactor().GenerateRecoveryCodes(userID)
+		return err
+	})
+	return codes, err
+}
+
+// DisableTwoFactor forgets the user's TOTP secret and recovery codes.
+func (s *UserService) DisableTwoFactor(userID uint) error {
+	return s.store.Transaction(func(tx repository.Store) error {
+		err := tx.Users().Update(userID, map[string]interface{}{
+			"totp_secret":     "",
+			"totp_enabled_at": nil,
+			"totp_last_step":  0,
+		})
+		if err != nil {
+			return err
+		}
+		return tx.TwoFactor().DeleteRecoveryCodes(userID)
+	})
+}
+
+// CreateAPIKey makes a new API key for the user unless they already have
+// MaxActiveAPIKeys working ones. It returns the key itself too, which is not
+// stored.
+func (s *UserService) CreateAPIKey(userID uint, name string, scopes []string, expiresAt *time.Time) (*models.APIKey, string, error) {
+	active, err := s.store.APIKeys().CountActive(userID)
+	if err != nil {
+		return nil, "", err
+	}
+	if active >= MaxActiveAPIKeys {
+		return nil, "", utils.NewBadRequestError("Too many API keys, please revoke one first")
+	}
+	return s.store.APIKeys().Create(userID, name, scopes, expiresAt)
+}
+
+// FindOrLinkIdentity returns the user linked to the provider account. An
+// unlinked account is linked to the user with the same email, or to a new
+// user, but only when the provider verified the email.
+func (s *UserService) FindOrLinkIdentity(identity *oidc.Identity) (*models.User, error) {
+	link, err := s.store.Identities().FindBySubject(identity.Provider, identity.Subject)
+	if err == nil {
+		user, err := s.store.Users().FindByID(link.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if user.DeletedAt != nil {
+			return nil, utils.NewForbiddenError("This account has been deleted")
+		}
+		return user, nil
+	}
+	if !errors.Is(err, repository.ErrNotFound) {
+		return nil, err
+	}
+
+	email := utils.NormalizeEmail(identity.Email)
+	if email == "" || !identity.EmailVerified {
+		return nil, utils.NewForbiddenError("The login provider did not confirm your email address")
+	}
+
+	var user *models.User
+	err = s.store.Transaction(func(tx repository.Store) error {
+		now := time.Now()
+		var err error
+		user, err = tx.Users().FindActiveByEmail(email)
+		switch {
+		case errors.Is(err, repository.ErrNotFound):
+			user = &models.User{
+				Email:           email,
+				FirstName:       identity.GivenName,
+				LastName:        identity.FamilyName,
+				EmailVerifiedAt: &now,
+			}
+			if user.FirstName == "" {
+				user.FirstName, _, _ = strings.Cut(email, "@")
+			}
+			// No password: the user signs in through the provider or sets
+			// one with the password reset flow
+			if err := tx.Users().Create(user); err != nil {
+				return err
+			}
+
+		case err != nil:
+			return err
+
+		case user.EmailVerifiedAt == nil:
+			// Nobody had proven they own this address, so whoever registered
+			// it may not be the person now signing in. Drop their password,
+			// sessions and API keys before handing the account over.
+			err := tx.Users().Update(user.ID, map[string]interface{}{
+				"password_hash":     "",
+				"email_verified_at": now,
+			})
+			if err != nil {
+				return err
+			}
+			if err := tx.Sessions().RevokeAll(user.ID); err != nil {
+				return err
+			}
+			if err := tx.APIKeys().RevokeAll(user.ID); err != nil {
+				return err
+			}
+			user.Password = ""
+			user.EmailVerifiedAt = &now
+		}
+
+		return tx.Identities().Create(&models.UserIdentity{
+			UserID:    user.ID,
+			Provider:  identity.Provider,
+			Subject:   identity.Subject,
+			Email:     email,
+			CreatedAt: now,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 
@@ -8,9 +9,16 @@ import (
 )
 
 type APIError struct {
-	Code    int    `json:"code"`
+	Code    int          `json:"code"`
+	Message string       `json:"message"`
+	Detail  string       `json:"detail,omitempty"`
+	Errors  []FieldError `json:"errors,omitempty"`
+}
+
+// FieldError explains why a single field of the request body was rejected.
+type FieldError struct {
+	Field   string `json:"field"`
 	Message string `json:"message"`
-	Detail  string `json:"detail,omitempty"`
 }
 
 func (e *APIError) Error() string {
@@ -33,6 +41,15 @@ func NewBadRequestError(message string) *APIError {
 	}
 }
 
+func NewValidationError(errors []FieldError) *APIError {
+	return &APIError{
+		Code:    http.StatusBadRequest,
+		Message: "Invalid input",
+		Detail:  "Validation failed",
+		Errors:  errors,
+	}
+}
+
 func NewInternalError(message string) *APIError {
 	return &APIError{
 		Code:    http.StatusInternalServerError,
@@ -49,6 +66,40 @@ func NewUnauthorizedError(message string) *APIError {
 	}
 }
 
+func NewTooManyRequestsError(message string) *APIError {
+	return &APIError{
+		Code:    http.StatusTooManyRequests,
+		Message: message,
+		Detail:  "Too many requests",
+	}
+}
+
+func NewConflictError(message string) *APIError {
+	return &APIError{
+		Code:    http.StatusConflict,
+		Message: message,
+		Detail:  "Conflicting request",
+	}
+}
+
+func NewForbiddenError(message string) *APIError {
+	return &APIError{
+		Code:    http.StatusForbidden,
+		Message: message,
+		Detail:  "Access forbidden",
+	}
+}
+
+// ToAPIError returns err as an *APIError, or an internal error with the given
+// message when err is of another type.
+func ToAPIError(err error, message string) *APIError {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+	return NewInternalError(message)
+}
+
 func HandleError(c echo.Context, err *APIError) error {
 	return c.JSON(err.Code, err)
 }
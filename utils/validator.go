@@ -0,0 +1,186 @@
+package utils
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/go-playground/validator/v10/non-standard/validators"
+	"github.com/labstack/echo/v4"
+)
+
+// Validator checks request bodies against their `validate` struct tags. Besides
+// the standard rules it knows the following, where phone and birthdate accept
+// an empty value so it can be used to clear the field:
+//
+//	phone      8 to 15 digits with an optional leading +, spaces and dashes allowed
+//	birthdate  a YYYY-MM-DD date between 1900-01-01 and today
+//	password   8 to 72 characters with at least one letter and one digit
+//	notblank   not empty and not only whitespace
+type Validator struct {
+	validate *validator.Validate
+}
+
+var phonePattern = regexp.MustCompile(`^\+?[0-9]{8,15}$`)
+
+// NewValidator returns the validator used for every request body. It is
+// registered as the echo validator so handlers can call c.Validate.
+func NewValidator() *Validator {
+	v := validator.New(validator.WithRequiredStructEnabled())
+
+	// Report fields by their JSON name, which is what clients send
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+		if name == "-" {
+			return ""
+		}
+		if name == "" {
+			return field.Name
+		}
+		return name
+	})
+
+	v.RegisterValidation("phone", func(fl validator.FieldLevel) bool {
+		phone := NormalizePhone(fl.Field().String())
+		return phone == "" || phonePattern.MatchString(phone)
+	})
+	v.RegisterValidation("birthdate", func(fl validator.FieldLevel) bool {
+		if fl.Field().String() == "" {
+			return true
+		}
+		date, err := time.Parse("2006-01-02", fl.Field().String())
+		if err != nil {
+			return false
+		}
+		return date.Year() >= 1900 && !date.After(time.Now())
+	})
+	v.RegisterValidation("password", func(fl validator.FieldLevel) bool {
+		password := fl.Field().String()
+		if len(password) < 8 || len(password) > 72 {
+			return false
+		}
+		hasLetter := strings.IndexFunc(password, unicode.IsLetter) >= 0
+		hasDigit := strings.IndexFunc(password, unicode.IsDigit) >= 0
+		return hasLetter && hasDigit
+	})
+	v.RegisterValidation("notblank", validators.NotBlank)
+
+	return &Validator{validate: v}
+}
+
+// Validate implements echo.Validator. Rule violations are returned as a
+// validation *APIError listing every invalid field.
+func (v *Validator) Validate(i interface{}) error {
+	err := v.validate.Struct(i)
+	if err == nil {
+		return nil
+	}
+
+	validationErrors, ok := err.(validator.ValidationErrors)
+	if !ok {
+		return NewBadRequestError("Invalid input")
+	}
+
+	fields := make([]FieldError, 0, len(validationErrors))
+	for _, fe := range validationErrors {
+		fields = append(fields, FieldError{
+			Field:   fieldPath(fe),
+			Message: fieldMessage(fe),
+		})
+	}
+	return NewValidationError(fields)
+}
+
+// normalizer is implemented by inputs that tidy up what people type, such as
+// the case of an email address, before it is validated.
+type normalizer interface {
+	Normalize()
+}
+
+// BindAndValidate binds the request into input, normalizes it when it has a
+// Normalize method and validates it. A body that cannot be decoded gives a
+// plain bad request error.
+func BindAndValidate(c echo.Context, input interface{}) *APIError {
+	if err := c.Bind(input); err != nil {
+		return NewBadRequestError("Invalid input")
+	}
+	if n, ok := input.(normalizer); ok {
+		n.Normalize()
+	}
+	if err := c.Validate(input); err != nil {
+		return ToAPIError(err, "Failed to validate input")
+	}
+	return nil
+}
+
+// NormalizeEmail trims an email address and lowercases it, as addresses that
+// only differ in case belong to the same account.
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// NormalizePhone removes the spaces and dashes people type in phone numbers.
+func NormalizePhone(phone string) string {
+	return strings.NewReplacer(" ", "", "-", "").Replace(strings.TrimSpace(phone))
+}
+
+// fieldPath drops the struct name from the namespace, e.g.
+// "ReturnInput.barcodes[1]" becomes "barcodes[1]".
+func fieldPath(fe validator.FieldError) string {
+	namespace := fe.Namespace()
+	if i := strings.Index(namespace, "."); i >= 0 {
+		return namespace[i+1:]
+	}
+	return namespace
+}
+
+func fieldMessage(fe validator.FieldError) string {
+	isString := fe.Kind() == reflect.String
+	isList := fe.Kind() == reflect.Slice || fe.Kind() == reflect.Array || fe.Kind() == reflect.Map
+
+	switch fe.Tag() {
+	case "required", "notblank":
+		return "is required"
+	case "email":
+		return "must be a valid email address"
+	case "phone":
+		return "must be a phone number of 8 to 15 digits"
+	case "birthdate":
+		return "must be a date in the format YYYY-MM-DD between 1900 and today"
+	case "password":
+		return "must be 8 to 72 characters and contain at least one letter and one digit"
+	case "ip":
+		return "must be a valid IP address"
+	case "unique":
+		return "must not contain duplicates"
+	case "oneof":
+		return fmt.Sprintf("must be one of: %s", fe.Param())
+	case "min":
+		if isString {
+			return fmt.Sprintf("must be at least %s characters", fe.Param())
+		}
+		if isList {
+			return fmt.Sprintf("must contain at least %s items", fe.Param())
+		}
+		return fmt.Sprintf("must be at least %s", fe.Param())
+	case "max":
+		if isString {
+			return fmt.Sprintf("must be at most %s characters", fe.Param())
+		}
+		if isList {
+			return fmt.Sprintf("must contain at most %s items", fe.Param())
+		}
+		return fmt.Sprintf("must be at most %s", fe.Param())
+	case "gt":
+		return fmt.Sprintf("must be greater than %s", fe.Param())
+	case "gte":
+		return fmt.Sprintf("must be at least %s", fe.Param())
+	case "lte":
+		return fmt.Sprintf("must be at most %s", fe.Param())
+	}
+	return "is invalid"
+}